@@ -1,22 +1,12 @@
 package beta
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
-	"net/url"
-	"regexp"
-
-	"golang.org/x/net/html"
-)
-
-const (
-	testFlightHost = "testflight.apple.com"
-	pathLen        = 14
-	joinPathPart   = "/join/"
+	"sync"
+	"time"
 )
 
 var (
@@ -32,139 +22,179 @@ var (
 	// if HTTP status is not 200.
 	ErrStatusNotOK = errors.New("HTTP status is not 200")
 )
-var re = regexp.MustCompile(`the (.*) beta`)
 
 // Beta is TestFlight beta.
-// It helps to check whether beta is full.
+// It helps to check status of the beta.
 // Also, Beta helps to get an app name that beta belongs.
 type Beta struct {
-	link    string
-	appName string
+	link string
+
+	mu       sync.RWMutex
+	appName  string
+	metadata Metadata
 
-	client *http.Client
-	req    *http.Request
+	client         *http.Client // http.DefaultClient is used if it is nil
+	requestTimeout time.Duration
 }
 
 // NewTFBeta returns new TestFlight beta.
+// Link is canonicalized by ParseLink.
 // ErrInvalidTestFlightLink can be returned if link is invalid.
+// If app name can not be extracted, PlaceholderAppName is used
+// until name is found by one of the next checks.
 func NewTFBeta(link string) (*Beta, error) {
-	if !isValid(link) {
-		return nil, ErrInvalidTestFlightLink
+	return NewTFBetaContext(context.Background(), link)
+}
+
+// NewTFBetaContext is like NewTFBeta
+// but TestFlight page is requested with the given context.
+func NewTFBetaContext(ctx context.Context, link string) (*Beta, error) {
+	return NewTFBetaWithOptions(ctx, link, Options{})
+}
+
+// Options are options of requests of the beta to TestFlight.
+type Options struct {
+	// Client is HTTP client of requests.
+	// http.DefaultClient is used if it is nil.
+	Client *http.Client
+	// RequestTimeout limits each HTTP request,
+	// so waits for rate limit and retries are not limited by it.
+	// Zero value means no limit.
+	RequestTimeout time.Duration
+}
+
+// NewTFBetaWithOptions is like NewTFBetaContext
+// but TestFlight page is requested with the given options.
+// Options are kept for checks of the beta.
+func NewTFBetaWithOptions(ctx context.Context, link string, opts Options) (*Beta, error) {
+	link, err := ParseLink(link)
+	if err != nil {
+		return nil, err
 	}
 
-	appName, err := extractAppName(link)
+	resp, err := get(ctx, opts.Client, link, opts.RequestTimeout)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnexpected, err)
+	}
+
+	switch resp.statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
 		return nil, ErrInvalidTestFlightLink
+	default:
+		return nil, ErrStatusNotOK
 	}
 
-	req, err := http.NewRequest(http.MethodGet, link, nil)
+	appName, md, err := extractInfo(link, resp.body)
 	if err != nil {
-		panic(err)
+		appName = PlaceholderAppName
 	}
 
 	return &Beta{
-		link:    link,
-		appName: appName,
-		client:  http.DefaultClient,
-		req:     req,
+		link:           link,
+		appName:        appName,
+		metadata:       md,
+		client:         opts.Client,
+		requestTimeout: opts.RequestTimeout,
 	}, nil
 }
 
-// IsFull returns whether beta is full or not.
-func (r *Beta) IsFull() (bool, error) {
-	resp, err := r.client.Do(r.req)
+// RestoreTFBeta returns TestFlight beta
+// using app name and metadata that are already known.
+// Unlike NewTFBeta, it does not request TestFlight page.
+// ErrInvalidTestFlightLink can be returned if link is invalid.
+func RestoreTFBeta(link, appName string, md Metadata) (*Beta, error) {
+	link, err := ParseLink(link)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return false, ErrStatusNotOK
+	if appName == "" {
+		appName = PlaceholderAppName
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	return &Beta{
+		link:     link,
+		appName:  appName,
+		metadata: md,
+	}, nil
+}
+
+// Check checks the beta and returns its status.
+// If TestFlight returned unexpected HTTP status,
+// ErrStatusNotOK is returned along with the result.
+// App name and metadata of the beta are updated if page contains them.
+func (r *Beta) Check() (CheckResult, error) {
+	return r.CheckContext(context.Background())
+}
+
+// CheckContext is like Check
+// but TestFlight page is requested with the given context.
+func (r *Beta) CheckContext(ctx context.Context) (CheckResult, error) {
+	resp, err := get(ctx, r.client, r.link, r.requestTimeout)
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", ErrUnexpected, err)
+		return CheckResult{}, err
+	}
+
+	res := detectStatus(resp.statusCode, resp.body)
+	if res.Status == StatusUnknown && resp.statusCode != http.StatusOK {
+		return res, ErrStatusNotOK
+	}
+
+	if resp.statusCode == http.StatusOK {
+		appName, md, err := extractInfo(r.link, resp.body)
+		if err == nil {
+			res.AppName = appName
+			res.Metadata = md
+			r.setInfo(appName, md)
+		}
 	}
 
-	isFull := bytes.Contains(body, []byte("This beta is full."))
-	return isFull, nil
+	return res, nil
 }
 
 // GetAppName returns app name that beta belongs.
 func (r *Beta) GetAppName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	return r.appName
 }
 
+// GetMetadata returns metadata of the beta app.
+func (r *Beta) GetMetadata() Metadata {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.metadata
+}
+
+func (r *Beta) setInfo(appName string, md Metadata) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.appName = appName
+	r.metadata = md
+}
+
 // GetLink returns beta link.
 func (r *Beta) GetLink() string {
 	return r.link
 }
 
 // WithClient overrides HTTP client.
+// Nil client means http.DefaultClient.
 func (r *Beta) WithClient(client *http.Client) *Beta {
 	r.client = client
 	return r
 }
 
-func isValid(link string) bool {
-	u, err := url.Parse(link)
-	if err != nil {
-		return false
-	}
-
-	if u.Host != testFlightHost || len(u.Path) != pathLen || u.Path[0:6] != joinPathPart {
-		return false
-	}
-
-	return true
-}
-
-func extractAppName(link string) (string, error) {
-	resp, err := http.Get(link)
-	if err != nil {
-		return "", fmt.Errorf("%s: %w", ErrUnexpected, err)
-	}
-	defer func(body io.ReadCloser) {
-		_ = body.Close()
-	}(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return "", ErrStatusNotOK
-	}
-
-	z := html.NewTokenizer(resp.Body)
-	var (
-		isTitle bool
-		title   []byte
-	)
-
-	const titleTag = "title"
-cl:
-	for {
-		tt := z.Next()
-		switch tt {
-		case html.ErrorToken:
-			err = z.Err()
-			if err != io.EOF {
-				return "", err
-			}
-			break cl
-		case html.StartTagToken, html.EndTagToken:
-			if z.Token().Data == titleTag {
-				isTitle = true
-			}
-		case html.TextToken:
-			if isTitle {
-				title = z.Text()
-				break cl
-			}
-		}
-	}
-
-	match := re.FindSubmatch(title)
-	if len(match) < 2 {
-		panic("unexpected to not submatch")
-	}
-
-	return string(match[1]), nil
+// WithRequestTimeout limits duration of each HTTP request
+// that is done by the beta. Zero timeout means no limit.
+func (r *Beta) WithRequestTimeout(timeout time.Duration) *Beta {
+	r.requestTimeout = timeout
+	return r
 }
@@ -0,0 +1,87 @@
+package beta
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimit = 2
+	defaultRateBurst = 5
+)
+
+// limiter limits requests to TestFlight.
+// It is shared by all betas, because Apple limits requests by host.
+var limiter = newHostLimiter(defaultRateLimit, defaultRateBurst)
+
+// SetRateLimit sets maximum rate of requests per second to TestFlight
+// and maximum burst size. The limit is shared by all betas.
+// Zero rps disables the limit.
+func SetRateLimit(rps float64, burst int) {
+	limit := rate.Limit(rps)
+	if rps <= 0 {
+		limit = rate.Inf
+	}
+
+	limiter.rl.SetLimit(limit)
+	limiter.rl.SetBurst(burst)
+}
+
+// hostLimiter is token bucket limiter
+// that can also be blocked for some time
+// when host asks to slow down.
+type hostLimiter struct {
+	rl *rate.Limiter
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+func newHostLimiter(rps float64, burst int) *hostLimiter {
+	return &hostLimiter{
+		rl: rate.NewLimiter(rate.Limit(rps), burst),
+	}
+}
+
+// Wait blocks until request is allowed or ctx is done.
+func (l *hostLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	blockedUntil := l.blockedUntil
+	l.mu.Unlock()
+
+	if d := time.Until(blockedUntil); d > 0 {
+		err := sleep(ctx, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return l.rl.Wait(ctx)
+}
+
+// Block blocks all requests for duration d.
+func (l *hostLimiter) Block(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// sleep pauses for duration d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
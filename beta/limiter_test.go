@@ -0,0 +1,67 @@
+package beta
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHostLimiterBlock(t *testing.T) {
+	l := newHostLimiter(0, 1)
+	l.rl.SetLimit(rate.Inf)
+
+	l.Block(200 * time.Millisecond)
+	// shorter block does not shorten the longer one
+	l.Block(time.Millisecond)
+
+	start := time.Now()
+	err := l.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Fatalf("blocked limiter is passed in %s", d)
+	}
+
+	// limiter is not blocked anymore
+	start = time.Now()
+	err = l.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("limiter is passed in %s", d)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	useTestLimiter(t)
+
+	SetRateLimit(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		err := limiter.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request is allowed by burst, the others wait 50ms each
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("3 requests are done in %s", d)
+	}
+
+	// zero rate disables the limit
+	SetRateLimit(0, 1)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		err := limiter.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("100 requests are done in %s", d)
+	}
+}
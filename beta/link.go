@@ -0,0 +1,94 @@
+package beta
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	testFlightHost = "testflight.apple.com"
+	joinPathPart   = "/join/"
+	betaScheme     = "itms-beta"
+)
+
+var (
+	codeRe = regexp.MustCompile(`^[A-Za-z0-9]{8}$`)
+	// linkRe matches TestFlight links in arbitrary text.
+	linkRe = regexp.MustCompile(`(?i)(?:(?:https?|itms-beta)://)?testflight\.apple\.com/join/([a-z0-9]{8})\b`)
+)
+
+// ParseLink parses TestFlight link and returns its canonical form
+// https://testflight.apple.com/join/CODE.
+//
+// It accepts http and https links with optional trailing slash,
+// query and fragment, links with itms-beta scheme, links without scheme
+// and bare 8-character codes.
+// ErrInvalidTestFlightLink is returned if link has any other form.
+func ParseLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if codeRe.MatchString(link) {
+		return canonicalLink(link), nil
+	}
+
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", ErrInvalidTestFlightLink
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", betaScheme:
+	default:
+		return "", ErrInvalidTestFlightLink
+	}
+
+	if !strings.EqualFold(u.Hostname(), testFlightHost) || !strings.HasPrefix(u.Path, joinPathPart) {
+		return "", ErrInvalidTestFlightLink
+	}
+
+	code := strings.TrimSuffix(strings.TrimPrefix(u.Path, joinPathPart), "/")
+	if !codeRe.MatchString(code) {
+		return "", ErrInvalidTestFlightLink
+	}
+
+	return canonicalLink(code), nil
+}
+
+func canonicalLink(code string) string {
+	return "https://" + testFlightHost + joinPathPart + code
+}
+
+// LinkCode returns code of TestFlight link in any form that ParseLink accepts.
+// ErrInvalidTestFlightLink is returned if link is invalid.
+func LinkCode(link string) (string, error) {
+	link, err := ParseLink(link)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(link, canonicalLink("")), nil
+}
+
+// FindLinks returns canonical TestFlight links found in the text
+// in order of their first occurrence without duplicates.
+// Unlike ParseLink, it does not accept bare codes,
+// since any 8-character word looks like a code.
+func FindLinks(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range linkRe.FindAllStringSubmatch(text, -1) {
+		link := canonicalLink(match[1])
+		if seen[link] {
+			continue
+		}
+
+		seen[link] = true
+		links = append(links, link)
+	}
+
+	return links
+}
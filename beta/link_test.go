@@ -0,0 +1,109 @@
+package beta
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLink(t *testing.T) {
+	const canonical = "https://testflight.apple.com/join/AbCd1234"
+	tests := []struct {
+		link     string
+		expected string
+		err      error
+	}{
+		{link: canonical, expected: canonical},
+		{link: "http://testflight.apple.com/join/AbCd1234", expected: canonical},
+		{link: "testflight.apple.com/join/AbCd1234", expected: canonical},
+		{link: "itms-beta://testflight.apple.com/join/AbCd1234", expected: canonical},
+		{link: "ITMS-BETA://TestFlight.Apple.com/join/AbCd1234", expected: canonical},
+		{link: "https://testflight.apple.com/join/AbCd1234/", expected: canonical},
+		{link: "https://testflight.apple.com/join/AbCd1234?ref=share", expected: canonical},
+		{link: "https://testflight.apple.com/join/AbCd1234/?ref=share#top", expected: canonical},
+		{link: "  https://testflight.apple.com/join/AbCd1234\n", expected: canonical},
+		{link: "AbCd1234", expected: canonical},
+		{link: "", err: ErrInvalidTestFlightLink},
+		{link: "AbCd123", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/AbCd123", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/AbCd12345", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/AbCd-123", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/AbCd1234/extra", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/AbCd1234", err: ErrInvalidTestFlightLink},
+		{link: "https://example.com/join/AbCd1234", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com.example.com/join/AbCd1234", err: ErrInvalidTestFlightLink},
+		{link: "ftp://testflight.apple.com/join/AbCd1234", err: ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/%zz", err: ErrInvalidTestFlightLink},
+	}
+
+	for _, tt := range tests {
+		link, err := ParseLink(tt.link)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseLink(%q) error = %v, want %v", tt.link, err, tt.err)
+			continue
+		}
+		if link != tt.expected {
+			t.Errorf("ParseLink(%q) = %q, want %q", tt.link, link, tt.expected)
+		}
+	}
+}
+
+func TestLinkCode(t *testing.T) {
+	code, err := LinkCode("itms-beta://testflight.apple.com/join/AbCd1234/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "AbCd1234" {
+		t.Fatalf("unexpected code %q", code)
+	}
+
+	_, err = LinkCode("https://example.com")
+	if !errors.Is(err, ErrInvalidTestFlightLink) {
+		t.Fatalf("expected ErrInvalidTestFlightLink, got %v", err)
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{
+			text:     "",
+			expected: nil,
+		},
+		{
+			text: "New betas: https://testflight.apple.com/join/AAAAAAAA, " +
+				"testflight.apple.com/join/BBBBBBBB/ and itms-beta://testflight.apple.com/join/CCCCCCCC?ref=1",
+			expected: []string{
+				"https://testflight.apple.com/join/AAAAAAAA",
+				"https://testflight.apple.com/join/BBBBBBBB",
+				"https://testflight.apple.com/join/CCCCCCCC",
+			},
+		},
+		{
+			// repeated links are returned once in order of first occurrence
+			text: "http://testflight.apple.com/join/BBBBBBBB\n" +
+				"https://testflight.apple.com/join/AAAAAAAA\n" +
+				"https://TESTFLIGHT.apple.com/join/BBBBBBBB",
+			expected: []string{
+				"https://testflight.apple.com/join/BBBBBBBB",
+				"https://testflight.apple.com/join/AAAAAAAA",
+			},
+		},
+		{
+			// bare codes and invalid codes are not links
+			text: "AAAAAAAA testflight.apple.com/join/AAAA " +
+				"testflight.apple.com/join/AAAAAAAAA https://example.com/join/AAAAAAAA",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		links := FindLinks(tt.text)
+		if !reflect.DeepEqual(links, tt.expected) {
+			t.Errorf("FindLinks(%q) = %v, want %v", tt.text, links, tt.expected)
+		}
+	}
+}
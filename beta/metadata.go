@@ -0,0 +1,56 @@
+package beta
+
+import "regexp"
+
+// Metadata is information about beta app found on TestFlight page.
+// Any field may be empty if page does not contain it.
+type Metadata struct {
+	IconURL     string
+	Description string
+	Platforms   []string // iOS, iPadOS, macOS, tvOS, watchOS or visionOS
+	Developer   string
+}
+
+// IsZero returns whether metadata has no information.
+func (m Metadata) IsZero() bool {
+	return m.IconURL == "" && m.Description == "" && len(m.Platforms) == 0 && m.Developer == ""
+}
+
+// platforms are ordered as Apple orders them.
+// Device names are not matched, because every join page
+// mentions iPhone, iPad and Mac in its instructions.
+var platforms = []string{"iOS", "iPadOS", "macOS", "tvOS", "watchOS", "visionOS"}
+
+var platformRe = regexp.MustCompile(`\b(iOS|iPadOS|macOS|tvOS|watchOS|visionOS)\b`)
+
+// metadata extracts metadata from the page.
+func (p page) metadata() Metadata {
+	md := Metadata{
+		IconURL:     p.firstMeta("og:image", "twitter:image"),
+		Description: p.firstMeta("og:description", "twitter:description", "description"),
+		Developer:   p.firstMeta("author"),
+	}
+
+	found := make(map[string]bool)
+	for _, match := range platformRe.FindAllString(p.text, -1) {
+		found[match] = true
+	}
+	for _, name := range platforms {
+		if found[name] {
+			md.Platforms = append(md.Platforms, name)
+		}
+	}
+
+	return md
+}
+
+// firstMeta returns content of the first present meta tag.
+func (p page) firstMeta(keys ...string) string {
+	for _, key := range keys {
+		if content, ok := p.meta[key]; ok {
+			return content
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,165 @@
+package beta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PlaceholderAppName is app name of beta
+// whose name can not be extracted from TestFlight page yet.
+const PlaceholderAppName = "Unknown app"
+
+var (
+	// ErrAppNameNotFound is error that will be wrapped in ParseError
+	// if TestFlight page does not contain app name.
+	ErrAppNameNotFound = errors.New("app name not found")
+
+	// ErrMalformedPage is error that will be wrapped in ParseError
+	// if TestFlight page is not valid HTML.
+	ErrMalformedPage = errors.New("malformed page")
+)
+
+// ParseError is error that will be returned
+// if TestFlight page can not be parsed.
+type ParseError struct {
+	Link string
+	Err  error
+}
+
+// Error implements error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse TestFlight page %s: %s", e.Link, e.Err)
+}
+
+// Unwrap returns underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var appNameRe = regexp.MustCompile(`(?i)join the (.+) beta`)
+
+// appNameMeta are meta tags that may contain app name
+// in order of their priority.
+var appNameMeta = []string{
+	"og:title",
+	"twitter:title",
+	"title",
+}
+
+// page is parsed TestFlight page.
+type page struct {
+	title string
+	meta  map[string]string // contents of meta tags by property or name
+	text  string            // visible text of body
+}
+
+// parsePage parses TestFlight page.
+func parsePage(link string, body []byte) (page, error) {
+	p := page{meta: make(map[string]string)}
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	var (
+		isTitle  bool
+		isBody   bool
+		isHidden bool // whether text is inside script or style tag
+		text     strings.Builder
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			err := z.Err()
+			if err != io.EOF {
+				return page{}, &ParseError{Link: link, Err: fmt.Errorf("%s: %w", ErrMalformedPage, err)}
+			}
+			p.text = text.String()
+			return p, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.Data {
+			case "title":
+				isTitle = p.title == ""
+			case "meta":
+				p.addMeta(token.Attr)
+			case "body":
+				isBody = true
+			case "script", "style":
+				isHidden = tt == html.StartTagToken
+			}
+		case html.EndTagToken:
+			isTitle = false
+			isHidden = false
+		case html.TextToken:
+			switch {
+			case isTitle:
+				p.title = strings.TrimSpace(string(z.Text()))
+			case isBody && !isHidden:
+				text.Write(z.Text())
+				text.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func (p *page) addMeta(attrs []html.Attribute) {
+	var key, content string
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "property", "name":
+			key = attr.Val
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+
+	if key != "" && content != "" {
+		p.meta[key] = content
+	}
+}
+
+// appName returns app name found in title or meta tags.
+// ErrAppNameNotFound is returned if no one contains it.
+func (p page) appName() (string, error) {
+	candidates := []string{p.title}
+	for _, key := range appNameMeta {
+		candidates = append(candidates, p.meta[key])
+	}
+
+	for _, candidate := range candidates {
+		match := appNameRe.FindStringSubmatch(candidate)
+		if len(match) < 2 {
+			continue
+		}
+
+		name := strings.TrimSpace(match[1])
+		if name != "" {
+			return name, nil
+		}
+	}
+
+	return "", ErrAppNameNotFound
+}
+
+// extractInfo extracts app name and metadata from TestFlight page.
+// ParseError is returned if name can not be extracted,
+// but metadata that is found is returned anyway.
+func extractInfo(link string, body []byte) (string, Metadata, error) {
+	p, err := parsePage(link, body)
+	if err != nil {
+		return "", Metadata{}, err
+	}
+
+	md := p.metadata()
+	name, err := p.appName()
+	if err != nil {
+		return "", md, &ParseError{Link: link, Err: err}
+	}
+
+	return name, md, nil
+}
@@ -0,0 +1,160 @@
+package beta
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testLink = "https://testflight.apple.com/join/AAAAAAAA"
+
+// testPage is shortened TestFlight page of open beta.
+const testPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Join the My App beta - TestFlight - Apple</title>
+<meta property="og:title" content="Join the Other beta - TestFlight - Apple">
+<meta property="og:image" content=" https://example.com/icon.png ">
+<meta property="og:description" content="Help us test the new editor.">
+<meta name="description" content="Generic description">
+<meta name="author" content="My Company">
+<style>.platform::after { content: "tvOS"; }</style>
+</head>
+<body>
+<script>var platforms = ["watchOS"];</script>
+<div class="beta-status">
+<span>To join the My App beta, open this link on your iPhone, iPad, or Mac.</span>
+</div>
+<p>Requires macOS 12.0 or later and iOS 15.0 or later.</p>
+<p>Works on iPadOS.</p>
+</body>
+</html>`
+
+func TestExtractInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		appName  string
+		metadata Metadata
+		err      error
+	}{
+		{
+			name:    "full page",
+			body:    testPage,
+			appName: "My App",
+			metadata: Metadata{
+				IconURL:     "https://example.com/icon.png",
+				Description: "Help us test the new editor.",
+				Platforms:   []string{"iOS", "iPadOS", "macOS"},
+				Developer:   "My Company",
+			},
+		},
+		{
+			name: "name in meta tag",
+			body: `<html><head><title>TestFlight - Apple</title>` +
+				`<meta name="twitter:title" content="Join the Tweeted beta">` +
+				`<meta name="twitter:description" content="From twitter">` +
+				`</head><body>visionOS</body></html>`,
+			appName: "Tweeted",
+			metadata: Metadata{
+				Description: "From twitter",
+				Platforms:   []string{"visionOS"},
+			},
+		},
+		{
+			name: "localized page",
+			body: `<html><head><title>Rejoindre la bêta Mon App - TestFlight - Apple</title>` +
+				`<meta property="og:description" content="Aidez-nous">` +
+				`<meta name="author" content="Société">` +
+				`</head><body><p>Nécessite iOS 15.0</p></body></html>`,
+			metadata: Metadata{
+				Description: "Aidez-nous",
+				Platforms:   []string{"iOS"},
+				Developer:   "Société",
+			},
+			err: ErrAppNameNotFound,
+		},
+		{
+			name:    "truncated page",
+			body:    `<html><head><title>Join the Cut beta</title><meta property="og:image" content="https://exa`,
+			appName: "Cut",
+		},
+		{
+			name: "malformed page",
+			body: `<html><head><title>Join the Broken beta</title>` +
+				`<meta name="author" content="Dev" <meta content=><<>` +
+				`</head><body></p></div></span>iOS<br/ tvOS>\x00</html></body>`,
+			appName: "Broken",
+			metadata: Metadata{
+				Platforms: []string{"iOS"},
+			},
+		},
+		{
+			name:    "empty title",
+			body:    `<html><head><title>   </title><title>Join the Second beta</title></head></html>`,
+			appName: "Second",
+		},
+		{
+			name: "empty page",
+			err:  ErrAppNameNotFound,
+		},
+		{
+			name: "binary",
+			body: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+			err:  ErrAppNameNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appName, md, err := extractInfo(testLink, []byte(tt.body))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) || parseErr.Link != testLink {
+					t.Errorf("expected ParseError of the link, got %v", err)
+				}
+			}
+			if appName != tt.appName {
+				t.Errorf("expected app name %q, got %q", tt.appName, appName)
+			}
+			if !reflect.DeepEqual(md, tt.metadata) {
+				t.Errorf("unexpected metadata: %+v", md)
+			}
+		})
+	}
+}
+
+func TestExtractInfoTruncated(t *testing.T) {
+	// page may be cut at any byte, e.g. if connection is closed
+	for i := 0; i <= len(testPage); i++ {
+		_, _, err := extractInfo(testLink, []byte(testPage[:i]))
+		if err != nil && !errors.Is(err, ErrAppNameNotFound) && !errors.Is(err, ErrMalformedPage) {
+			t.Fatalf("unexpected error of page truncated at %d: %v", i, err)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	p, err := parsePage(testLink, []byte(testPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.title != "Join the My App beta - TestFlight - Apple" {
+		t.Errorf("unexpected title %q", p.title)
+	}
+	if p.meta["og:title"] != "Join the Other beta - TestFlight - Apple" || p.meta["author"] != "My Company" {
+		t.Errorf("unexpected meta tags: %v", p.meta)
+	}
+	// text of scripts and styles is not visible
+	for _, hidden := range []string{"watchOS", "tvOS"} {
+		if strings.Contains(p.text, hidden) {
+			t.Errorf("hidden text %q is in page text: %q", hidden, p.text)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package beta
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxRetries  = 3
+	baseBackoff = time.Second
+	maxBackoff  = time.Minute
+)
+
+// response is a read HTTP response of TestFlight.
+type response struct {
+	statusCode int
+	body       []byte
+}
+
+// get requests TestFlight page respecting the host limiter.
+// If TestFlight asks to slow down, request is retried
+// with exponential backoff or after time passed in Retry-After header.
+// requestTimeout limits each attempt, zero value means no limit.
+// http.DefaultClient is used if client is nil.
+func get(ctx context.Context, client *http.Client, link string, requestTimeout time.Duration) (response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := limiter.Wait(ctx)
+		if err != nil {
+			return response{}, err
+		}
+
+		resp, header, err := doGet(ctx, client, link, requestTimeout)
+		if err != nil {
+			return response{}, err
+		}
+
+		if !isRetryable(resp.statusCode) || attempt == maxRetries {
+			return resp, nil
+		}
+
+		delay := backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), time.Now()); ok && retryAfter > delay {
+			delay = retryAfter
+		}
+		limiter.Block(delay)
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			return response{}, err
+		}
+	}
+}
+
+func doGet(ctx context.Context, client *http.Client, link string, requestTimeout time.Duration) (response, http.Header, error) {
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return response{}, nil, fmt.Errorf("%w: %v", ErrUnexpected, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return response{}, nil, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return response{}, nil, fmt.Errorf("%w: %v", ErrUnexpected, err)
+	}
+
+	return response{statusCode: resp.StatusCode, body: body}, resp.Header, nil
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// backoff returns exponential delay with jitter for the attempt.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << attempt
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+
+	// the delay is randomized in [d/2, d)
+	// to not retry requests of all betas at the same time.
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// parseRetryAfter parses Retry-After header value.
+// It may be either delay in seconds or HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
@@ -0,0 +1,271 @@
+package beta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// serverTransport sends all requests to the test server.
+type serverTransport struct {
+	url *url.URL
+}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.url.Scheme
+	req.URL.Host = t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestClient returns client whose requests are served by handler.
+// Handler receives number of request.
+func newTestClient(t *testing.T, handler func(w http.ResponseWriter, n int)) *http.Client {
+	t.Helper()
+
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n++
+		i := n
+		mu.Unlock()
+
+		handler(w, i)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Client{Transport: serverTransport{url: u}}
+}
+
+// useTestLimiter replaces the shared limiter with unlimited one,
+// so blocks of the test do not affect other tests.
+func useTestLimiter(t *testing.T) {
+	t.Helper()
+
+	prev := limiter
+	limiter = newHostLimiter(0, 1)
+	limiter.rl.SetLimit(rate.Inf)
+	t.Cleanup(func() {
+		limiter = prev
+	})
+}
+
+func newTestBeta(t *testing.T, client *http.Client) *Beta {
+	t.Helper()
+
+	b, err := RestoreTFBeta("https://testflight.apple.com/join/AAAAAAAA", "App", Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b.WithClient(client)
+}
+
+func TestCheckRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		// retryAfter returns value of Retry-After header
+		// that asks to retry in 2 or more seconds.
+		retryAfter func(now time.Time) string
+	}{
+		{
+			name:       "seconds",
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: func(time.Time) string { return "2" },
+		},
+		{
+			// date is truncated to seconds
+			name:       "date",
+			statusCode: http.StatusServiceUnavailable,
+			retryAfter: func(now time.Time) string { return now.Add(3 * time.Second).UTC().Format(http.TimeFormat) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestLimiter(t)
+
+			var (
+				mu       sync.Mutex
+				requests []time.Time
+			)
+			client := newTestClient(t, func(w http.ResponseWriter, n int) {
+				now := time.Now()
+				mu.Lock()
+				requests = append(requests, now)
+				mu.Unlock()
+
+				if n == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter(now))
+					w.WriteHeader(tt.statusCode)
+					return
+				}
+				_, _ = fmt.Fprint(w, `<p>To join the App beta, install TestFlight.</p>`)
+			})
+
+			res, err := newTestBeta(t, client).CheckContext(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != StatusOpen {
+				t.Fatalf("unexpected status: %s", res.Status)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(requests) != 2 {
+				t.Fatalf("expected 2 requests, got %d", len(requests))
+			}
+			// backoff of the first retry is less than a second,
+			// so delay is taken from Retry-After
+			if d := requests[1].Sub(requests[0]); d < 2*time.Second {
+				t.Fatalf("request is retried after %s", d)
+			}
+		})
+	}
+}
+
+func TestCheckNotRetryable(t *testing.T) {
+	useTestLimiter(t)
+
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	client := newTestClient(t, func(w http.ResponseWriter, i int) {
+		mu.Lock()
+		n = i
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := newTestBeta(t, client).CheckContext(context.Background())
+	if !errors.Is(err, ErrStatusNotOK) {
+		t.Fatalf("expected ErrStatusNotOK, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCheckCancelRetry(t *testing.T) {
+	useTestLimiter(t)
+
+	client := newTestClient(t, func(w http.ResponseWriter, _ int) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := newTestBeta(t, client).CheckContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("check is canceled in %s", d)
+	}
+
+	// host asked to slow down, so other betas wait too
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = limiter.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected limiter to be blocked, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "120", expected: 2 * time.Minute, ok: true},
+		{value: "0", expected: 0, ok: true},
+		{value: now.Add(30 * time.Second).Format(http.TimeFormat), expected: 30 * time.Second, ok: true},
+		{value: now.Add(time.Hour).Format(time.RFC850), expected: time.Hour, ok: true},
+		// date in the past means retry right now
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0, ok: true},
+		{value: "", ok: false},
+		{value: "-1", ok: false},
+		{value: "1.5", ok: false},
+		{value: "soon", ok: false},
+		{value: "2022-01-01T12:00:30Z", ok: false},
+	}
+
+	for _, tt := range tests {
+		d, ok := parseRetryAfter(tt.value, now)
+		if ok != tt.ok || d != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", tt.value, d, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 0, max: baseBackoff},
+		{attempt: 1, max: 2 * baseBackoff},
+		{attempt: 3, max: 8 * baseBackoff},
+		{attempt: 10, max: maxBackoff},
+		// shift overflows
+		{attempt: 63, max: maxBackoff},
+		{attempt: 100, max: maxBackoff},
+	}
+
+	for _, tt := range tests {
+		// delay is random, so it is checked many times
+		for i := 0; i < 100; i++ {
+			d := backoff(tt.attempt)
+			if d < tt.max/2 || d >= tt.max {
+				t.Fatalf("backoff(%d) = %s, want it in [%s, %s)", tt.attempt, d, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   bool
+	}{
+		{http.StatusTooManyRequests, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusOK, false},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(tt.statusCode); got != tt.expected {
+			t.Errorf("isRetryable(%d) = %t, want %t", tt.statusCode, got, tt.expected)
+		}
+	}
+}
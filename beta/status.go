@@ -0,0 +1,140 @@
+package beta
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Status is status of TestFlight beta.
+type Status int
+
+const (
+	// StatusUnknown means that status of beta can not be determined.
+	// For example, Apple returned an error page or the page layout is changed.
+	StatusUnknown Status = iota
+	// StatusOpen means that beta has free slots.
+	StatusOpen
+	// StatusFull means that beta has no free slots.
+	StatusFull
+	// StatusNotAccepting means that beta does not accept new testers.
+	StatusNotAccepting
+	// StatusNotFound means that beta does not exist.
+	StatusNotFound
+)
+
+// String returns text representation of the status.
+// It is stable, so it can be stored.
+func (s Status) String() string {
+	switch s {
+	case StatusOpen:
+		return "open"
+	case StatusFull:
+		return "full"
+	case StatusNotAccepting:
+		return "not_accepting"
+	case StatusNotFound:
+		return "not_found"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseStatus returns status by its text representation.
+// StatusUnknown is returned for unknown text.
+func ParseStatus(s string) Status {
+	for _, status := range []Status{StatusOpen, StatusFull, StatusNotAccepting, StatusNotFound} {
+		if status.String() == s {
+			return status
+		}
+	}
+
+	return StatusUnknown
+}
+
+// CheckResult is result of beta check.
+type CheckResult struct {
+	Status Status
+
+	// StatusCode is HTTP status code of TestFlight page.
+	StatusCode int
+	// Evidence is a fragment of TestFlight page
+	// that the status is determined by.
+	Evidence string
+	// AppName is app name found on TestFlight page.
+	// It is empty if page does not contain it.
+	AppName string
+	// Metadata is metadata found on TestFlight page.
+	// It is filled only if AppName is found.
+	Metadata Metadata
+}
+
+// marker is a text that TestFlight page contains in some status.
+type marker struct {
+	status Status
+	text   []byte
+}
+
+// markers are checked in order, so the open markers must be the last ones,
+// because full page may contain them too.
+var markers = []marker{
+	{status: StatusFull, text: []byte("This beta is full.")},
+	{status: StatusNotAccepting, text: []byte("isn't accepting any new testers")},
+	{status: StatusNotAccepting, text: []byte("isn’t accepting any new testers")},
+	{status: StatusNotAccepting, text: []byte("isn&#39;t accepting any new testers")},
+	{status: StatusNotAccepting, text: []byte("is not accepting any new testers")},
+	{status: StatusOpen, text: []byte("To join the")},
+	{status: StatusOpen, text: []byte("itms-beta://")},
+}
+
+// detectStatus determines beta status by HTTP status code and page body.
+func detectStatus(statusCode int, body []byte) CheckResult {
+	res := CheckResult{
+		Status:     StatusUnknown,
+		StatusCode: statusCode,
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		res.Status = StatusNotFound
+		res.Evidence = http.StatusText(statusCode)
+		return res
+	default:
+		res.Evidence = http.StatusText(statusCode)
+		return res
+	}
+
+	for _, m := range markers {
+		i := bytes.Index(body, m.text)
+		if i == -1 {
+			continue
+		}
+
+		res.Status = m.status
+		res.Evidence = evidence(body, i, len(m.text))
+		return res
+	}
+
+	return res
+}
+
+// evidence returns fragment of body between tags
+// that contains match at position i.
+func evidence(body []byte, i, matchLen int) string {
+	const maxLen = 256
+
+	start := bytes.LastIndexAny(body[:i], "<>") + 1
+	end := i + matchLen
+	if j := bytes.IndexAny(body[end:], "<>"); j != -1 {
+		end += j
+	} else {
+		end = len(body)
+	}
+
+	fragment := bytes.TrimSpace(body[start:end])
+	if len(fragment) > maxLen {
+		fragment = fragment[:maxLen]
+	}
+
+	return string(fragment)
+}
@@ -0,0 +1,139 @@
+package beta
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		status     Status
+		evidence   string
+	}{
+		{
+			name:       "full",
+			statusCode: http.StatusOK,
+			body:       `<div class="beta-status"><span>This beta is full.</span></div>`,
+			status:     StatusFull,
+			evidence:   "This beta is full.",
+		},
+		{
+			// full page contains instructions how to join too
+			name:       "full with join instructions",
+			statusCode: http.StatusOK,
+			body:       `<p>To join the App beta, open the link.</p><span> This beta is full. </span>`,
+			status:     StatusFull,
+			evidence:   "This beta is full.",
+		},
+		{
+			name:       "not accepting",
+			statusCode: http.StatusOK,
+			body:       `<span>This beta isn't accepting any new testers right now.</span>`,
+			status:     StatusNotAccepting,
+			evidence:   "This beta isn't accepting any new testers right now.",
+		},
+		{
+			name:       "not accepting with typographic apostrophe",
+			statusCode: http.StatusOK,
+			body:       `<span>This beta isn’t accepting any new testers right now.</span>`,
+			status:     StatusNotAccepting,
+			evidence:   "This beta isn’t accepting any new testers right now.",
+		},
+		{
+			name:       "not accepting with escaped apostrophe",
+			statusCode: http.StatusOK,
+			body:       `<span>This beta isn&#39;t accepting any new testers right now.</span>`,
+			status:     StatusNotAccepting,
+			evidence:   "This beta isn&#39;t accepting any new testers right now.",
+		},
+		{
+			name:       "not accepting without contraction",
+			statusCode: http.StatusOK,
+			body:       `<span>This beta is not accepting any new testers right now.</span>`,
+			status:     StatusNotAccepting,
+			evidence:   "This beta is not accepting any new testers right now.",
+		},
+		{
+			name:       "open",
+			statusCode: http.StatusOK,
+			body:       `<p>To join the App beta, install TestFlight.</p>`,
+			status:     StatusOpen,
+			evidence:   "To join the App beta, install TestFlight.",
+		},
+		{
+			name:       "open by beta link",
+			statusCode: http.StatusOK,
+			body:       `<a href="itms-beta://testflight.apple.com/join/AAAAAAAA">View in TestFlight</a>`,
+			status:     StatusOpen,
+			evidence:   `a href="itms-beta://testflight.apple.com/join/AAAAAAAA"`,
+		},
+		{
+			name:       "not found",
+			statusCode: http.StatusNotFound,
+			body:       `<p>To join the App beta</p>`,
+			status:     StatusNotFound,
+			evidence:   "Not Found",
+		},
+		{
+			name:       "gone",
+			statusCode: http.StatusGone,
+			status:     StatusNotFound,
+			evidence:   "Gone",
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusInternalServerError,
+			body:       `<p>This beta is full.</p>`,
+			status:     StatusUnknown,
+			evidence:   "Internal Server Error",
+		},
+		{
+			name:       "unknown layout",
+			statusCode: http.StatusOK,
+			body:       `<p>Something new</p>`,
+			status:     StatusUnknown,
+		},
+		{
+			name:       "empty page",
+			statusCode: http.StatusOK,
+			status:     StatusUnknown,
+		},
+		{
+			name:       "marker without tags",
+			statusCode: http.StatusOK,
+			body:       "This beta is full.",
+			status:     StatusFull,
+			evidence:   "This beta is full.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := detectStatus(tt.statusCode, []byte(tt.body))
+			if res.Status != tt.status {
+				t.Errorf("expected status %s, got %s", tt.status, res.Status)
+			}
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("expected status code %d, got %d", tt.statusCode, res.StatusCode)
+			}
+			if res.Evidence != tt.evidence {
+				t.Errorf("expected evidence %q, got %q", tt.evidence, res.Evidence)
+			}
+		})
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, status := range []Status{StatusUnknown, StatusOpen, StatusFull, StatusNotAccepting, StatusNotFound} {
+		if parsed := ParseStatus(status.String()); parsed != status {
+			t.Errorf("ParseStatus(%q) = %s, want %s", status.String(), parsed, status)
+		}
+	}
+
+	if status := ParseStatus("closed"); status != StatusUnknown {
+		t.Errorf("unexpected status of unknown text: %s", status)
+	}
+}
@@ -1,15 +1,18 @@
 package main
 
 import (
-	"database/sql"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"git.sr.ht/~mcldresner/tfdog/recovery"
 
+	"git.sr.ht/~mcldresner/tfdog/beta"
 	"git.sr.ht/~mcldresner/tfdog/config"
 	"git.sr.ht/~mcldresner/tfdog/logger"
 	"git.sr.ht/~mcldresner/tfdog/repository"
@@ -23,7 +26,17 @@ import (
 )
 
 func main() {
-	cfg := getConfig()
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		// migrator is closed by runMigrate before the process exits
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg := getConfig(os.Args[1:])
 	log := getLogger(cfg)
 	defer func(log *zap.Logger) {
 		_ = log.Sync()
@@ -38,29 +51,40 @@ func main() {
 	}(repo)
 
 	srv := getService(cfg, log, repo)
+
+	b, handlers := getBot(cfg, log, srv)
+	queue := bot.NewDeliveryQueue(b, getDeliveryConfig(cfg, log))
+	defer func(queue *bot.DeliveryQueue) {
+		_ = queue.Close()
+	}(queue)
+	// service is closed before the queue,
+	// so notifications being delivered stay pending in outbox
 	defer func(srv service.Service) {
 		err := srv.Close()
 		if err != nil {
 			log.With(zap.Error(err)).Error("failed to close service")
 		}
 	}(srv)
-
-	b := getBot(cfg, log, srv)
-
-	recoveryFromRepository(srv, repo, b, log)
+	// handlers are closed before the service,
+	// so requests to the service are canceled and imports are finished
+	defer func(handlers io.Closer) {
+		_ = handlers.Close()
+	}(handlers)
+	srv.RegisterNotifier(bot.NewNotifier(queue))
+
+	recoveryFromRepository(srv, repo, log)
 	handleStop(b, log)
 
 	log.Info("starting...")
 	b.Start()
 }
 
-func getConfig() ini.File {
-	const argsLen = 2
-	if len(os.Args) < argsLen {
+func getConfig(args []string) ini.File {
+	if len(args) == 0 {
 		panic("config path must be passed")
 	}
 
-	cfgPath := os.Args[1]
+	cfgPath := args[0]
 	cfg, err := config.LoadConfig(cfgPath)
 	if err != nil {
 		panic(err)
@@ -102,7 +126,7 @@ func getLogger(cfg ini.File) *zap.Logger {
 	return log
 }
 
-func getBot(cfg ini.File, log *zap.Logger, srv service.Service) *tb.Bot {
+func getBot(cfg ini.File, log *zap.Logger, srv service.Service) (*tb.Bot, io.Closer) {
 	cfgLog := log.Named("config").With(zap.String("section", "bot"))
 	botCfg := cfg.Section("bot")
 
@@ -132,7 +156,7 @@ func getBot(cfg ini.File, log *zap.Logger, srv service.Service) *tb.Bot {
 	}
 	startText = strings.ReplaceAll(helpText, "\\n", "\n")
 
-	b, err := bot.NewBot(
+	b, handlers, err := bot.NewBot(
 		pollerTimeout,
 		token,
 		srv,
@@ -143,11 +167,71 @@ func getBot(cfg ini.File, log *zap.Logger, srv service.Service) *tb.Bot {
 		log.With(zap.Error(err)).Panic("failed to create bot")
 	}
 
-	return b
+	return b, handlers
+}
+
+func getDeliveryConfig(cfg ini.File, log *zap.Logger) bot.DeliveryConfig {
+	cfgLog := log.Named("config").With(zap.String("section", "bot"))
+	botCfg := cfg.Section("bot")
+
+	// defaults are below limits of Telegram:
+	// 30 messages per second overall and 1 message per second to one chat
+	deliveryCfg := bot.DeliveryConfig{
+		Rate:         25,
+		Burst:        25,
+		ChatInterval: time.Second,
+		Workers:      8,
+		MaxAttempts:  5,
+		Backoff:      time.Second,
+		MaxBackoff:   time.Minute,
+	}
+
+	var err error
+	if value, ok := botCfg["send_rate"]; ok {
+		deliveryCfg.Rate, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			cfgLog.With(zap.Error(err)).Panic("failed to parse send rate")
+		}
+		// burst follows the rate unless it is set explicitly,
+		// rate below 1 message per second still allows a single message
+		deliveryCfg.Burst = int(deliveryCfg.Rate)
+		if deliveryCfg.Burst < 1 {
+			deliveryCfg.Burst = 1
+		}
+	}
+	if value, ok := botCfg["send_burst"]; ok {
+		deliveryCfg.Burst, err = strconv.Atoi(value)
+		if err != nil {
+			cfgLog.With(zap.Error(err)).Panic("failed to parse send burst")
+		}
+		if deliveryCfg.Burst < 1 {
+			cfgLog.Panic("send burst must be at least 1")
+		}
+	}
+	if value, ok := botCfg["send_chat_interval"]; ok {
+		deliveryCfg.ChatInterval, err = time.ParseDuration(value)
+		if err != nil {
+			cfgLog.With(zap.Error(err)).Panic("failed to parse send chat interval")
+		}
+	}
+	if value, ok := botCfg["send_workers"]; ok {
+		deliveryCfg.Workers, err = strconv.Atoi(value)
+		if err != nil {
+			cfgLog.With(zap.Error(err)).Panic("failed to parse send workers")
+		}
+	}
+	if value, ok := botCfg["send_attempts"]; ok {
+		deliveryCfg.MaxAttempts, err = strconv.Atoi(value)
+		if err != nil {
+			cfgLog.With(zap.Error(err)).Panic("failed to parse send attempts")
+		}
+	}
+
+	return deliveryCfg
 }
 
 func handleStop(b *tb.Bot, log *zap.Logger) {
-	termChan := make(chan os.Signal)
+	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	go func() {
@@ -158,15 +242,10 @@ func handleStop(b *tb.Bot, log *zap.Logger) {
 }
 
 func getRepository(cfg ini.File, log *zap.Logger) repository.Repository {
-	dsn, ok := cfg.Get("database", "data_source_name")
-	if !ok {
-		log.
-			Named("config").
-			With(zap.String("section", "database")).
-			Panic("config must contain data_source_name field")
-	}
+	driver := getDriver(cfg)
+	dsn := getDataSourceName(cfg, log)
 
-	err := migrate(dsn)
+	err := migrate(driver, dsn, log.Named("migration"))
 	if err != nil {
 		log.
 			Named("migration").
@@ -174,36 +253,57 @@ func getRepository(cfg ini.File, log *zap.Logger) repository.Repository {
 			Panic("failed to migrate database")
 	}
 
-	repo, err := repository.NewSqliteRepository(dsn)
+	repo, err := repository.New(driver, dsn)
 	if err != nil {
 		log.
 			Named("repository").
 			With(zap.Error(err)).
-			Panic("failed to create new sqlite repo")
+			With(zap.String("driver", driver)).
+			Panic("failed to create new repo")
 	}
 
 	return repo
 }
 
-const migrateQuery = `
-CREATE TABLE IF NOT EXISTS subscriptions
-(
-    user_id  int,
-    app_name text,
-    link     text
-);
-`
-
-func migrate(dsn string) error {
-	db, err := sql.Open("sqlite3", dsn)
+// getDriver returns database driver, sqlite is used by default.
+func getDriver(cfg ini.File) string {
+	driver, ok := cfg.Get("database", "driver")
+	if !ok {
+		return repository.DriverSqlite
+	}
+
+	return driver
+}
+
+func getDataSourceName(cfg ini.File, log *zap.Logger) string {
+	dsn, ok := cfg.Get("database", "data_source_name")
+	if !ok {
+		log.
+			Named("config").
+			With(zap.String("section", "database")).
+			Panic("config must contain data_source_name field")
+	}
+
+	return dsn
+}
+
+// migrate applies pending migrations to database.
+func migrate(driver, dsn string, log *zap.Logger) error {
+	m, err := repository.NewMigrator(driver, dsn)
 	if err != nil {
 		return err
 	}
-	defer func(db *sql.DB) {
-		_ = db.Close()
-	}(db)
+	defer func(m *repository.Migrator) {
+		_ = m.Close()
+	}(m)
 
-	_, err = db.Exec(migrateQuery)
+	applied, err := m.Up()
+	for _, migration := range applied {
+		log.
+			With(zap.Int("version", migration.Version)).
+			With(zap.String("name", migration.Name)).
+			Info("migration is applied")
+	}
 	if err != nil {
 		return err
 	}
@@ -227,12 +327,147 @@ func getService(cfg ini.File, log *zap.Logger, repo repository.Repository) servi
 		log.With(zap.Error(err)).Panic("failed to parse interval")
 	}
 
-	srv := service.NewService(repo, interval)
+	notifyClosed := false
+	value, ok = cfg.Get("scheduler", "notify_closed")
+	if ok {
+		notifyClosed, err = strconv.ParseBool(value)
+		if err != nil {
+			log.With(zap.Error(err)).Panic("failed to parse notify_closed")
+		}
+	}
+
+	requestTimeoutStr, ok := cfg.Get("scheduler", "request_timeout")
+	if !ok {
+		requestTimeoutStr = "10s"
+	}
+	requestTimeout, err := time.ParseDuration(requestTimeoutStr)
+	if err != nil {
+		log.With(zap.Error(err)).Panic("failed to parse request timeout")
+	}
+
+	checkTimeoutStr, ok := cfg.Get("scheduler", "check_timeout")
+	if !ok {
+		checkTimeoutStr = "1m"
+	}
+	checkTimeout, err := time.ParseDuration(checkTimeoutStr)
+	if err != nil {
+		log.With(zap.Error(err)).Panic("failed to parse check timeout")
+	}
+
+	reconcileIntervalStr, ok := cfg.Get("scheduler", "reconcile_interval")
+	if !ok {
+		reconcileIntervalStr = "10m"
+	}
+	reconcileInterval, err := time.ParseDuration(reconcileIntervalStr)
+	if err != nil {
+		log.With(zap.Error(err)).Panic("failed to parse reconcile interval")
+	}
+
+	rateLimit := 2.0
+	value, ok = cfg.Get("scheduler", "rate_limit")
+	if ok {
+		rateLimit, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.With(zap.Error(err)).Panic("failed to parse rate limit")
+		}
+	}
+
+	rateBurst := 5
+	value, ok = cfg.Get("scheduler", "rate_burst")
+	if ok {
+		rateBurst, err = strconv.Atoi(value)
+		if err != nil {
+			log.With(zap.Error(err)).Panic("failed to parse rate burst")
+		}
+	}
+	if rateLimit > 0 && rateBurst < 1 {
+		log.Panic("rate burst must be at least 1 if rate limit is set")
+	}
+	beta.SetRateLimit(rateLimit, rateBurst)
+
+	retention, downsampleAfter, downsampleInterval := getHistoryConfig(cfg, log)
+
+	dispatchIntervalStr, ok := cfg.Get("outbox", "dispatch_interval")
+	if !ok {
+		dispatchIntervalStr = "5s"
+	}
+	dispatchInterval, err := time.ParseDuration(dispatchIntervalStr)
+	if err != nil {
+		log.With(zap.Error(err)).Panic("failed to parse dispatch interval")
+	}
+
+	dispatchWorkers := 8
+	value, ok = cfg.Get("outbox", "workers")
+	if ok {
+		dispatchWorkers, err = strconv.Atoi(value)
+		if err != nil {
+			log.With(zap.Error(err)).Panic("failed to parse outbox workers")
+		}
+	}
+
+	dispatchAttempts := 10
+	value, ok = cfg.Get("outbox", "attempts")
+	if ok {
+		dispatchAttempts, err = strconv.Atoi(value)
+		if err != nil {
+			log.With(zap.Error(err)).Panic("failed to parse outbox attempts")
+		}
+	}
+
+	srv := service.NewService(repo, service.Config{
+		Interval:                  interval,
+		NotifyClosed:              notifyClosed,
+		RequestTimeout:            requestTimeout,
+		CheckTimeout:              checkTimeout,
+		ReconcileInterval:         reconcileInterval,
+		HistoryRetention:          retention,
+		HistoryDownsampleAfter:    downsampleAfter,
+		HistoryDownsampleInterval: downsampleInterval,
+		DispatchInterval:          dispatchInterval,
+		DispatchWorkers:           dispatchWorkers,
+		DispatchAttempts:          dispatchAttempts,
+	})
 	return srv
 }
 
-func recoveryFromRepository(srv service.Service, repo repository.Repository, b *tb.Bot, log *zap.Logger) {
-	err := recovery.ServiceFromRepository(srv, repo, b)
+// getHistoryConfig returns retention, downsampling age
+// and downsampling interval of check history.
+func getHistoryConfig(cfg ini.File, log *zap.Logger) (time.Duration, time.Duration, time.Duration) {
+	durations := []struct {
+		key          string
+		defaultValue string
+		value        time.Duration
+	}{
+		{key: "retention", defaultValue: "2160h"},
+		{key: "downsample_after", defaultValue: "168h"},
+		{key: "downsample_interval", defaultValue: "1h"},
+	}
+
+	for i := range durations {
+		value, ok := cfg.Get("history", durations[i].key)
+		if !ok {
+			value = durations[i].defaultValue
+		}
+
+		var err error
+		durations[i].value, err = time.ParseDuration(value)
+		if err != nil {
+			log.
+				With(zap.Error(err)).
+				With(zap.String("key", durations[i].key)).
+				Panic("failed to parse history config")
+		}
+	}
+
+	if durations[1].value > 0 && durations[2].value < time.Second {
+		log.Panic("history downsample interval must be at least 1s")
+	}
+
+	return durations[0].value, durations[1].value, durations[2].value
+}
+
+func recoveryFromRepository(srv service.Service, repo repository.Repository, log *zap.Logger) {
+	err := recovery.ServiceFromRepository(srv, repo)
 	if err != nil {
 		log.With(zap.Error(err)).Panic("failed to recovery service from repository")
 	}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/config"
+	"git.sr.ht/~mcldresner/tfdog/repository"
+)
+
+const (
+	migrateCommand = "migrate"
+	migrateUsage   = "usage: tfdog migrate status|up /path/to/config"
+)
+
+// errMigrateUsage is returned if migrate command is called with wrong arguments.
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate runs migrate command:
+//
+//	tfdog migrate status /path/to/config
+//	tfdog migrate up /path/to/config
+//
+// Logger is not configured for the command,
+// so errors are returned to be printed by the caller.
+func runMigrate(args []string) error {
+	const argsLen = 2
+	if len(args) != argsLen {
+		return errMigrateUsage
+	}
+
+	action := args[0]
+	if action != "status" && action != "up" {
+		return errMigrateUsage
+	}
+
+	cfg, err := config.LoadConfig(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	dsn, ok := cfg.Get("database", "data_source_name")
+	if !ok {
+		return errors.New("config must contain data_source_name field")
+	}
+
+	m, err := repository.NewMigrator(getDriver(cfg), dsn)
+	if err != nil {
+		return fmt.Errorf("failed to create migrator: %w", err)
+	}
+	defer func(m *repository.Migrator) {
+		_ = m.Close()
+	}(m)
+
+	switch action {
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get migrations status: %w", err)
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.IsApplied() {
+				state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Printf("%04d_%s\tapplied\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	}
+
+	return nil
+}
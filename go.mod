@@ -4,11 +4,13 @@ go 1.17
 
 require (
 	github.com/go-co-op/gocron v1.11.0
+	github.com/lib/pq v1.10.4
 	github.com/mattn/go-sqlite3 v1.14.10
 	github.com/vaughan0/go-ini v0.0.0-20130923145212-a98ad7ee00ec
 	go.uber.org/atomic v1.9.0
 	go.uber.org/zap v1.20.0
 	golang.org/x/net v0.0.0-20220127074510-2fabfed7e28f
+	golang.org/x/time v0.0.0-20220210224613-90d013bbcef8
 	gopkg.in/tucnak/telebot.v2 v2.5.0
 )
 
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// WithUserSaver saves profile of the user on every interaction.
+// Updates are passed even if profile can not be saved.
+func WithUserSaver(srv service.Service) Middleware {
+	return func(upd *tb.Update) bool {
+		sender := getSender(upd)
+		if sender == nil {
+			return true
+		}
+
+		// error is logged by the service
+		_ = srv.SaveUser(service.User{
+			User: repository.User{
+				ID:           int(sender.ID),
+				Username:     sender.Username,
+				LanguageCode: sender.LanguageCode,
+			},
+		})
+
+		return true
+	}
+}
+
+func getSender(upd *tb.Update) *tb.User {
+	switch {
+	case upd.Message != nil:
+		return upd.Message.Sender
+	case upd.Callback != nil:
+		return upd.Callback.Sender
+	default:
+		return nil
+	}
+}
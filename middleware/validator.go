@@ -1,10 +1,6 @@
 package middleware
 
-import (
-	"strings"
-
-	tb "gopkg.in/tucnak/telebot.v2"
-)
+import tb "gopkg.in/tucnak/telebot.v2"
 
 // WithValidator validates incoming updates.
 func WithValidator() Middleware {
@@ -17,23 +13,8 @@ func WithValidator() Middleware {
 	}
 }
 
+// validateMessage passes private messages of users.
+// Commands are validated by handlers, so users are told what is wrong.
 func validateMessage(m *tb.Message) bool {
-	if !m.Private() || m.Sender.IsBot {
-		return false
-	}
-
-	if !strings.HasPrefix(m.Text, "/subscribe") {
-		return true
-	}
-
-	if len(m.Entities) != 2 {
-		return false
-	}
-
-	entity := m.Entities[1]
-	if entity.Type != tb.EntityURL {
-		return false
-	}
-
-	return true
+	return m.Private() && !m.Sender.IsBot
 }
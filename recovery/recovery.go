@@ -1,34 +1,92 @@
 package recovery
 
 import (
+	"errors"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
 	"git.sr.ht/~mcldresner/tfdog/repository"
 	"git.sr.ht/~mcldresner/tfdog/service"
-	"git.sr.ht/~mcldresner/tfdog/transport/bot"
-	tb "gopkg.in/tucnak/telebot.v2"
+	"go.uber.org/zap"
 )
 
 // ServiceFromRepository restores the service using a repository.
-func ServiceFromRepository(srv service.Service, repo repository.Repository, b *tb.Bot) error {
+// Subscriptions are restored from stored rows without requesting TestFlight.
+// Subscriptions with invalid links are quarantined, so they do not break startup.
+// Subscriptions that fail to restore for other reasons are kept,
+// so they are restored later by reconciliation of the service.
+func ServiceFromRepository(srv service.Service, repo repository.Repository) error {
+	logger := zap.L().Named("recovery")
+
 	subs, err := repo.GetAllSubscriptions()
 	if err != nil {
 		return err
 	}
-	if len(subs) == 0 {
-		return nil
+
+	var restored, inactive, quarantined, failed int
+	for _, sub := range subs {
+		if sub.Inactive {
+			// user is unreachable, so beta is not checked for them
+			inactive++
+			continue
+		}
+
+		err = restore(srv, repo, sub)
+		if err == nil {
+			restored++
+			continue
+		}
+
+		subLogger := logger.
+			With(zap.Int("user_id", sub.UserID)).
+			With(zap.String("link", sub.Link))
+		if !errors.Is(err, beta.ErrInvalidTestFlightLink) {
+			// error may be temporary, so subscription is not quarantined
+			subLogger.With(zap.Error(err)).Error("failed to restore subscription")
+			failed++
+			continue
+		}
+		subLogger.With(zap.Error(err)).Warn("subscription has invalid link")
+
+		err = repo.QuarantineSubscription(sub, err.Error())
+		if err != nil {
+			subLogger.With(zap.Error(err)).Error("failed to quarantine subscription")
+			continue
+		}
+		quarantined++
 	}
 
-	err = repo.DeleteAllSubscriptions()
+	logger.
+		With(zap.Int("restored", restored)).
+		With(zap.Int("inactive", inactive)).
+		With(zap.Int("quarantined", quarantined)).
+		With(zap.Int("failed", failed)).
+		Info("subscriptions are restored")
+
+	return nil
+}
+
+// restore restores subscription.
+// Link of subscription that was stored before links were canonicalized
+// is replaced with canonical one, so its status is kept.
+func restore(srv service.Service, repo repository.Repository, sub repository.Subscription) error {
+	link, err := beta.ParseLink(sub.Link)
 	if err != nil {
 		return err
 	}
 
-	for _, sub := range subs {
-		payload := bot.NewBetaPayload(b, &tb.User{ID: int64(sub.UserID)})
-		err = srv.Subscribe(sub.UserID, sub.Link, payload)
+	if link != sub.Link {
+		err = repo.UpdateSubscriptionLink(sub.UserID, sub.Link, link)
+		if errors.Is(err, repository.ErrAlreadyExists) {
+			// user has also subscribed the canonical link,
+			// so it will be restored by its own row.
+			return repo.RemoveSubscription(sub)
+		}
 		if err != nil {
 			return err
 		}
+
+		sub.Link = link
 	}
 
-	return nil
+	return srv.Restore(service.Subscription{Subscription: sub})
 }
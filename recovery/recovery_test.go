@@ -0,0 +1,176 @@
+package recovery
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/service"
+)
+
+const (
+	linkA = "https://testflight.apple.com/join/AAAAAAAA"
+	linkB = "https://testflight.apple.com/join/BBBBBBBB"
+	linkC = "https://testflight.apple.com/join/CCCCCCCC"
+)
+
+var errRestore = errors.New("restore failed")
+
+// fakeService records restored subscriptions.
+// Other methods of service.Service must not be called.
+type fakeService struct {
+	service.Service
+
+	restored []repository.Subscription
+	failing  map[string]error // errors of links that fail to restore
+}
+
+func (s *fakeService) Restore(sub service.Subscription) error {
+	if err := s.failing[sub.Link]; err != nil {
+		return err
+	}
+
+	s.restored = append(s.restored, sub.Subscription)
+	return nil
+}
+
+// withoutIDs zeroes IDs assigned by repository
+// and sorts subscriptions by user.
+func withoutIDs(subs []repository.Subscription) []repository.Subscription {
+	for i := range subs {
+		subs[i].ID = 0
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].UserID < subs[j].UserID
+	})
+	return subs
+}
+
+func TestServiceFromRepository(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, sub := range []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A"},
+		{UserID: 2, Link: "testflight.apple.com/join/AAAAAAAA/", AppName: "A"},
+		{UserID: 3, Link: "https://example.com", AppName: "Broken"},
+		{UserID: 4, Link: linkB, AppName: "B"},
+		{UserID: 5, Link: linkC, AppName: "C"},
+	} {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := &fakeService{failing: map[string]error{
+		linkB: errRestore,
+		linkC: beta.ErrInvalidTestFlightLink,
+	}}
+	err := ServiceFromRepository(srv, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A"},
+		{UserID: 2, Link: linkA, AppName: "A"},
+	}
+	if !reflect.DeepEqual(withoutIDs(srv.restored), expected) {
+		t.Fatalf("unexpected restored subscriptions: %+v", srv.restored)
+	}
+
+	// subscriptions with invalid links are quarantined,
+	// subscription that failed with another error is kept,
+	// legacy link is re-keyed
+	subs, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, repository.Subscription{UserID: 4, Link: linkB, AppName: "B"})
+	if !reflect.DeepEqual(withoutIDs(subs), expected) {
+		t.Fatalf("unexpected stored subscriptions: %+v", subs)
+	}
+}
+
+func TestServiceFromRepositoryDuplicateLegacyLink(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, sub := range []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A"},
+		{UserID: 1, Link: "http://testflight.apple.com/join/AAAAAAAA", AppName: "A"},
+	} {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := &fakeService{}
+	err := ServiceFromRepository(srv, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A"},
+	}
+	if !reflect.DeepEqual(withoutIDs(srv.restored), expected) {
+		t.Fatalf("unexpected restored subscriptions: %+v", srv.restored)
+	}
+
+	subs, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(withoutIDs(subs), expected) {
+		t.Fatalf("unexpected stored subscriptions: %+v", subs)
+	}
+}
+
+func TestServiceFromRepositoryKeepsLegacyStatus(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	legacy := repository.Subscription{
+		UserID:    1,
+		Link:      "itms-beta://testflight.apple.com/join/AAAAAAAA",
+		AppName:   "A",
+		CreatedAt: time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC),
+	}
+	err := repo.SaveSubscription(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.LastStatus = "open"
+	err = repo.SaveSubscriptionStatus(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fakeService{}
+	err = ServiceFromRepository(srv, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only link is changed, so the user is not notified
+	// about open beta again after restart
+	expected := before[0]
+	expected.Link = linkA
+	subs, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || !reflect.DeepEqual(subs[0], expected) {
+		t.Fatalf("unexpected stored subscriptions: %+v", subs)
+	}
+	if len(srv.restored) != 1 || !reflect.DeepEqual(srv.restored[0], expected) {
+		t.Fatalf("unexpected restored subscriptions: %+v", srv.restored)
+	}
+}
@@ -0,0 +1,599 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// subscriptionKey identifies subscription.
+type subscriptionKey struct {
+	userID int
+	link   string
+}
+
+// quarantinedSubscription is subscription moved out by QuarantineSubscription.
+type quarantinedSubscription struct {
+	sub    Subscription
+	reason string
+}
+
+// memoryRepo is in-memory implementation of Repository.
+// Data is lost when process exits.
+type memoryRepo struct {
+	mu          sync.RWMutex
+	subs        []Subscription // subs in order of saving
+	states      map[subscriptionKey]string
+	betas       map[string]BetaMetadata
+	quarantined []quarantinedSubscription
+	checks      []BetaCheck // checks in order of saving
+	users       map[int]User
+	outbox      []OutboxItem // outbox in order of IDs
+	outboxID    int64        // outboxID is ID of the last outbox item
+	subID       int64        // subID is ID of the last subscription
+}
+
+// NewMemoryRepository returns new in-memory Repository instance.
+// It is intended for tests.
+func NewMemoryRepository() Repository {
+	return &memoryRepo{
+		states: make(map[subscriptionKey]string),
+		betas:  make(map[string]BetaMetadata),
+		users:  make(map[int]User),
+	}
+}
+
+func (s *memoryRepo) SaveSubscription(sub Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(sub.UserID, sub.Link) >= 0 {
+		return ErrAlreadyExists
+	}
+
+	s.subID++
+	s.subs = append(s.subs, Subscription{
+		ID:        s.subID,
+		UserID:    sub.UserID,
+		Link:      sub.Link,
+		AppName:   sub.AppName,
+		CreatedAt: sub.CreatedAt.UTC(),
+	})
+	if sub.LastStatus != "" {
+		s.states[subscriptionKey{userID: sub.UserID, link: sub.Link}] = sub.LastStatus
+	}
+	return nil
+}
+
+func (s *memoryRepo) RemoveSubscription(sub Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(sub.UserID, sub.Link)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	s.subs = append(s.subs[:i], s.subs[i+1:]...)
+	delete(s.states, subscriptionKey{userID: sub.UserID, link: sub.Link})
+	return nil
+}
+
+func (s *memoryRepo) UpdateSubscriptionLink(userID int, oldLink, newLink string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(userID, oldLink)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if s.index(userID, newLink) >= 0 {
+		return ErrAlreadyExists
+	}
+
+	s.subs[i].Link = newLink
+
+	oldKey := subscriptionKey{userID: userID, link: oldLink}
+	newKey := subscriptionKey{userID: userID, link: newLink}
+	delete(s.states, newKey)
+	if status, ok := s.states[oldKey]; ok {
+		s.states[newKey] = status
+		delete(s.states, oldKey)
+	}
+
+	for i := range s.outbox {
+		if s.outbox[i].UserID == userID && s.outbox[i].Link == oldLink {
+			s.outbox[i].Link = newLink
+		}
+	}
+	return nil
+}
+
+func (s *memoryRepo) GetSubscription(userID int, id int64) (Subscription, error) {
+	subs := s.filter(func(sub Subscription) bool {
+		return sub.UserID == userID && sub.ID == id
+	})
+	if len(subs) == 0 {
+		return Subscription{}, ErrNotFound
+	}
+
+	return subs[0], nil
+}
+
+func (s *memoryRepo) GetUserSubscriptions(userID int) ([]Subscription, error) {
+	return s.filter(func(sub Subscription) bool {
+		return sub.UserID == userID
+	}), nil
+}
+
+func (s *memoryRepo) GetLinkSubscriptions(link string) ([]Subscription, error) {
+	return s.filter(func(sub Subscription) bool {
+		return sub.Link == link
+	}), nil
+}
+
+func (s *memoryRepo) GetAllSubscriptions() ([]Subscription, error) {
+	return s.filter(func(Subscription) bool {
+		return true
+	}), nil
+}
+
+func (s *memoryRepo) SaveSubscriptionStatus(sub Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(sub.UserID, sub.Link) < 0 {
+		return ErrNotFound
+	}
+
+	s.states[subscriptionKey{userID: sub.UserID, link: sub.Link}] = sub.LastStatus
+	return nil
+}
+
+func (s *memoryRepo) SaveSubscriptionStatusWithNotification(sub Subscription, item OutboxItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(sub.UserID, sub.Link) < 0 {
+		return ErrNotFound
+	}
+
+	s.states[subscriptionKey{userID: sub.UserID, link: sub.Link}] = sub.LastStatus
+
+	s.outboxID++
+	s.outbox = append(s.outbox, OutboxItem{
+		ID:            s.outboxID,
+		UserID:        item.UserID,
+		Link:          item.Link,
+		EventType:     item.EventType,
+		Status:        item.Status,
+		State:         OutboxPending,
+		CreatedAt:     item.CreatedAt.UTC(),
+		NextAttemptAt: item.CreatedAt.UTC(),
+	})
+	return nil
+}
+
+func (s *memoryRepo) GetPendingNotifications(now time.Time, limit int) ([]OutboxItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []OutboxItem
+	for _, item := range s.outbox {
+		if len(res) == limit {
+			break
+		}
+		if item.State == OutboxPending && !item.NextAttemptAt.After(now) {
+			res = append(res, item)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *memoryRepo) MarkNotificationDelivered(id int64, deliveredAt time.Time) error {
+	s.updateOutbox(id, func(item *OutboxItem) {
+		item.State = OutboxDelivered
+		item.Attempts++
+		item.CompletedAt = deliveredAt.UTC()
+	})
+	return nil
+}
+
+func (s *memoryRepo) MarkNotificationDropped(id int64, reason string, droppedAt time.Time) error {
+	s.updateOutbox(id, func(item *OutboxItem) {
+		item.State = OutboxDropped
+		item.LastError = reason
+		item.CompletedAt = droppedAt.UTC()
+	})
+	return nil
+}
+
+func (s *memoryRepo) RetryNotification(id int64, notifierMask int64, lastError string, nextAttemptAt time.Time) error {
+	s.updateOutbox(id, func(item *OutboxItem) {
+		item.Attempts++
+		item.NotifierMask = notifierMask
+		item.LastError = lastError
+		item.NextAttemptAt = nextAttemptAt.UTC()
+	})
+	return nil
+}
+
+func (s *memoryRepo) RemoveCompletedNotifications(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		removed int64
+		outbox  = s.outbox[:0]
+	)
+	for _, item := range s.outbox {
+		if item.State != OutboxPending && item.CompletedAt.Before(before) {
+			removed++
+			continue
+		}
+		outbox = append(outbox, item)
+	}
+	s.outbox = outbox
+
+	return removed, nil
+}
+
+func (s *memoryRepo) UpdateAppName(link, appName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.subs {
+		if s.subs[i].Link == link {
+			s.subs[i].AppName = appName
+		}
+	}
+	return nil
+}
+
+func (s *memoryRepo) SaveBetaMetadata(link string, md BetaMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.betas[link] = copyMetadata(md)
+	return nil
+}
+
+func (s *memoryRepo) SetUserSubscriptionsActive(userID int, isActive bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed int64
+	for i := range s.subs {
+		if s.subs[i].UserID == userID && s.subs[i].Inactive == isActive {
+			s.subs[i].Inactive = !isActive
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+func (s *memoryRepo) QuarantineSubscription(sub Subscription, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quarantined = append(s.quarantined, quarantinedSubscription{
+		sub:    sub,
+		reason: reason,
+	})
+
+	if i := s.index(sub.UserID, sub.Link); i >= 0 {
+		s.subs = append(s.subs[:i], s.subs[i+1:]...)
+	}
+	delete(s.states, subscriptionKey{userID: sub.UserID, link: sub.Link})
+	return nil
+}
+
+func (s *memoryRepo) SaveBetaCheck(check BetaCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check.CheckedAt = check.CheckedAt.UTC()
+	s.checks = append(s.checks, check)
+	return nil
+}
+
+func (s *memoryRepo) GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []BetaCheck
+	for _, check := range s.checks {
+		if check.Link == link && !check.CheckedAt.Before(from) && check.CheckedAt.Before(to) {
+			res = append(res, check)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].CheckedAt.Before(res[j].CheckedAt)
+	})
+
+	return res, nil
+}
+
+func (s *memoryRepo) GetLastBetaCheck(link string) (BetaCheck, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		res   BetaCheck
+		found bool
+	)
+	for _, check := range s.checks {
+		if check.Link == link && (!found || !check.CheckedAt.Before(res.CheckedAt)) {
+			res = check
+			found = true
+		}
+	}
+	if !found {
+		return BetaCheck{}, ErrBetaCheckNotFound
+	}
+
+	return res, nil
+}
+
+func (s *memoryRepo) RemoveBetaChecks(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeChecks(before, func(int) bool {
+		return true
+	}), nil
+}
+
+func (s *memoryRepo) DownsampleBetaChecks(before time.Time, interval time.Duration) (int64, error) {
+	seconds, err := intervalSeconds(interval)
+	if err != nil {
+		return 0, err
+	}
+
+	type bucket struct {
+		link   string
+		status string
+		number int64
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make(map[bucket]int) // index of kept check by bucket
+	for i, check := range s.checks {
+		if !check.CheckedAt.Before(before) {
+			continue
+		}
+
+		b := bucket{
+			link:   check.Link,
+			status: check.Status,
+			number: check.CheckedAt.Unix() / seconds,
+		}
+		if _, ok := kept[b]; !ok {
+			kept[b] = i
+		}
+	}
+
+	keptIndexes := make(map[int]struct{}, len(kept))
+	for _, i := range kept {
+		keptIndexes[i] = struct{}{}
+	}
+
+	return s.removeChecks(before, func(i int) bool {
+		_, ok := keptIndexes[i]
+		return !ok
+	}), nil
+}
+
+func (s *memoryRepo) SaveUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastSeenAt := user.LastSeenAt.UTC()
+	stored, ok := s.users[user.ID]
+	if !ok {
+		stored = User{
+			ID:        user.ID,
+			CreatedAt: lastSeenAt,
+		}
+	}
+
+	stored.Username = user.Username
+	stored.LanguageCode = user.LanguageCode
+	stored.LastSeenAt = lastSeenAt
+	s.users[user.ID] = stored
+	return nil
+}
+
+func (s *memoryRepo) GetUser(userID int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (s *memoryRepo) GetUsersSeenBefore(t time.Time) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []User
+	for _, user := range s.users {
+		if user.LastSeenAt.Before(t) {
+			res = append(res, copyUser(user))
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeenAt.Before(res[j].LastSeenAt)
+	})
+
+	return res, nil
+}
+
+func (s *memoryRepo) SetUserBlocked(userID int, isBlocked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.IsBlocked = isBlocked
+	s.users[userID] = user
+	return nil
+}
+
+func (s *memoryRepo) SaveUserPreferences(userID int, timezone string, preferences []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	user.Timezone = timezone
+	user.Preferences = preferences
+	s.users[userID] = copyUser(user)
+	return nil
+}
+
+func (s *memoryRepo) RemoveUserData(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := s.subs[:0]
+	for _, sub := range s.subs {
+		if sub.UserID != userID {
+			subs = append(subs, sub)
+		}
+	}
+	s.subs = subs
+
+	for key := range s.states {
+		if key.userID == userID {
+			delete(s.states, key)
+		}
+	}
+
+	quarantined := s.quarantined[:0]
+	for _, q := range s.quarantined {
+		if q.sub.UserID != userID {
+			quarantined = append(quarantined, q)
+		}
+	}
+	s.quarantined = quarantined
+
+	outbox := s.outbox[:0]
+	for _, item := range s.outbox {
+		if item.UserID != userID {
+			outbox = append(outbox, item)
+		}
+	}
+	s.outbox = outbox
+
+	delete(s.users, userID)
+	return nil
+}
+
+func (s *memoryRepo) Close() error {
+	return nil
+}
+
+// updateOutbox updates outbox item by its ID.
+func (s *memoryRepo) updateOutbox(id int64, update func(item *OutboxItem)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.outbox {
+		if s.outbox[i].ID == id {
+			update(&s.outbox[i])
+			return
+		}
+	}
+}
+
+// index returns index of subscription in subs or -1 if it is not found.
+func (s *memoryRepo) index(userID int, link string) int {
+	for i, sub := range s.subs {
+		if sub.UserID == userID && sub.Link == link {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// removeChecks removes checks made before the time
+// whose indexes are matched by f. Lock must be held by caller.
+// It returns count of removed checks.
+func (s *memoryRepo) removeChecks(before time.Time, f func(i int) bool) int64 {
+	var (
+		removed int64
+		checks  = s.checks[:0]
+	)
+	for i, check := range s.checks {
+		if check.CheckedAt.Before(before) && f(i) {
+			removed++
+			continue
+		}
+		checks = append(checks, check)
+	}
+	s.checks = checks
+
+	return removed
+}
+
+// filter returns subscriptions matched by f
+// along with their statuses and beta metadata.
+func (s *memoryRepo) filter(f func(sub Subscription) bool) []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []Subscription
+	for _, sub := range s.subs {
+		if !f(sub) {
+			continue
+		}
+
+		sub.LastStatus = s.states[subscriptionKey{userID: sub.UserID, link: sub.Link}]
+		sub.Metadata = copyMetadata(s.betas[sub.Link])
+		res = append(res, sub)
+	}
+
+	return res
+}
+
+// copyMetadata copies metadata, so stored one can not be changed by caller.
+// Empty platforms are stored as nil like in other repositories.
+func copyMetadata(md BetaMetadata) BetaMetadata {
+	if len(md.Platforms) == 0 {
+		md.Platforms = nil
+	} else {
+		md.Platforms = append([]string(nil), md.Platforms...)
+	}
+
+	return md
+}
+
+// copyUser copies user, so stored one can not be changed by caller.
+// Empty preferences are stored as nil like in other repositories.
+func copyUser(user User) User {
+	if len(user.Preferences) == 0 {
+		user.Preferences = nil
+	} else {
+		user.Preferences = append([]byte(nil), user.Preferences...)
+	}
+
+	return user
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration is numbered schema migration.
+type Migration struct {
+	Version int
+	Name    string
+
+	query string
+}
+
+// MigrationStatus describes whether migration is applied.
+type MigrationStatus struct {
+	Migration
+
+	// AppliedAt is time when migration was applied.
+	// It is zero if migration is pending.
+	AppliedAt time.Time
+}
+
+// IsApplied returns whether migration is applied.
+func (s MigrationStatus) IsApplied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// dialect describes SQL that differs between databases.
+type dialect struct {
+	dir                  string // directory of migrations
+	createTableQuery     string
+	insertMigrationQuery string
+}
+
+var sqliteDialect = dialect{
+	dir: "migrations/sqlite",
+	createTableQuery: `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    int PRIMARY KEY,
+    name       text      NOT NULL,
+    applied_at timestamp NOT NULL
+);
+`,
+	insertMigrationQuery: `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+}
+
+var postgresDialect = dialect{
+	dir: "migrations/postgres",
+	createTableQuery: `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    int PRIMARY KEY,
+    name       text      NOT NULL,
+    applied_at timestamp NOT NULL
+);
+`,
+	insertMigrationQuery: `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+}
+
+// Migrator applies forward-only migrations to database.
+// Applied migrations are tracked in schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewSqliteMigrator returns migrator of sqlite database.
+func NewSqliteMigrator(dsn string) (*Migrator, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	return newMigrator(db, sqliteDialect)
+}
+
+// NewPostgresMigrator returns migrator of postgres database.
+func NewPostgresMigrator(dsn string) (*Migrator, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	return newMigrator(db, postgresDialect)
+}
+
+// NewMigrator returns migrator of database of the driver.
+// ErrUnknownDriver is returned if driver is not supported.
+func NewMigrator(driver, dsn string) (*Migrator, error) {
+	switch driver {
+	case DriverSqlite:
+		return NewSqliteMigrator(dsn)
+	case DriverPostgres:
+		return NewPostgresMigrator(dsn)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, driver)
+	}
+}
+
+func newMigrator(db *sql.DB, d dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(d.dir)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    d,
+		migrations: migrations,
+	}, nil
+}
+
+// Status returns statuses of all known migrations ordered by version.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{
+			Migration: migration,
+			AppliedAt: applied[migration.Version],
+		}
+	}
+
+	return statuses, nil
+}
+
+// Up applies pending migrations in order of their versions.
+// It returns migrations that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Migration
+	for _, status := range statuses {
+		if status.IsApplied() {
+			continue
+		}
+
+		err = m.apply(status.Migration)
+		if err != nil {
+			return res, fmt.Errorf("failed to apply migration %04d_%s: %w", status.Version, status.Name, err)
+		}
+		res = append(res, status.Migration)
+	}
+
+	return res, nil
+}
+
+// Close closes database connection.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// applied returns times when migrations were applied by their versions.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	_, err := m.db.Exec(m.dialect.createTableQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	const query = `SELECT version, applied_at FROM schema_migrations`
+	rows, err := m.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	res := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		res[version] = appliedAt
+	}
+
+	return res, rows.Err()
+}
+
+// apply applies migration in transaction.
+func (m *Migrator) apply(migration Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	_, err = tx.Exec(migration.query)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(m.dialect.insertMigrationQuery, migration.Version, migration.Name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations loads migrations from dir.
+// Files must be named like 0001_name.sql.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	versions := make(map[int]string, len(entries))
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || path.Ext(fileName) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, ".sql")
+		parts := strings.SplitN(base, "_", 2)
+		const partsLen = 2
+		if len(parts) != partsLen {
+			return nil, fmt.Errorf("invalid migration file name %s", fileName)
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration %s: %w", fileName, err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, fileName)
+		}
+		versions[version] = fileName
+
+		query, err := fs.ReadFile(migrationsFS, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    parts[1],
+			query:   string(query),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS subscriptions
+(
+    user_id  bigint,
+    app_name text,
+    link     text
+);
+
+CREATE TABLE IF NOT EXISTS subscription_states
+(
+    user_id    bigint,
+    link       text,
+    status     text,
+    updated_at timestamp,
+    PRIMARY KEY (user_id, link)
+);
+
+CREATE TABLE IF NOT EXISTS betas
+(
+    link        text PRIMARY KEY,
+    icon_url    text,
+    description text,
+    platforms   text,
+    developer   text,
+    updated_at  timestamp
+);
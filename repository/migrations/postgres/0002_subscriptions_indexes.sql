@@ -0,0 +1,2 @@
+CREATE UNIQUE INDEX subscriptions_user_id_link_idx ON subscriptions (user_id, link);
+CREATE INDEX subscriptions_link_idx ON subscriptions (link);
@@ -0,0 +1,13 @@
+CREATE TABLE beta_checks
+(
+    id          bigserial PRIMARY KEY,
+    link        text        NOT NULL,
+    checked_at  timestamptz NOT NULL,
+    status      text        NOT NULL,
+    status_code int         NOT NULL,
+    latency_ms  bigint      NOT NULL,
+    error       text        NOT NULL
+);
+
+CREATE INDEX beta_checks_link_checked_at_idx ON beta_checks (link, checked_at);
+CREATE INDEX beta_checks_checked_at_idx ON beta_checks (checked_at);
@@ -0,0 +1,2 @@
+ALTER TABLE subscriptions
+    ADD COLUMN is_active boolean NOT NULL DEFAULT true;
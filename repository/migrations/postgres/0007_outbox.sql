@@ -0,0 +1,16 @@
+CREATE TABLE outbox
+(
+    id              bigserial PRIMARY KEY,
+    user_id         bigint      NOT NULL,
+    link            text        NOT NULL,
+    event_type      int         NOT NULL,
+    status          text        NOT NULL,
+    state           text        NOT NULL,
+    attempts        int         NOT NULL DEFAULT 0,
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL,
+    next_attempt_at timestamptz NOT NULL,
+    completed_at    timestamptz
+);
+
+CREATE INDEX outbox_state_next_attempt_at_idx ON outbox (state, next_attempt_at);
@@ -0,0 +1,3 @@
+-- created_at of subscriptions saved before the column was added is unknown.
+ALTER TABLE subscriptions
+    ADD COLUMN created_at timestamptz;
@@ -0,0 +1,4 @@
+-- notifications added before the column was added
+-- have not been delivered to any notifier.
+ALTER TABLE outbox
+    ADD COLUMN notifier_mask bigint NOT NULL DEFAULT 0;
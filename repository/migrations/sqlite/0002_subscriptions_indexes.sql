@@ -0,0 +1,7 @@
+-- Duplicates could be stored before the unique index was added.
+DELETE
+FROM subscriptions
+WHERE rowid NOT IN (SELECT MIN(rowid) FROM subscriptions GROUP BY user_id, link);
+
+CREATE UNIQUE INDEX subscriptions_user_id_link_idx ON subscriptions (user_id, link);
+CREATE INDEX subscriptions_link_idx ON subscriptions (link);
@@ -0,0 +1,8 @@
+CREATE TABLE quarantined_subscriptions
+(
+    user_id        int,
+    app_name       text,
+    link           text,
+    reason         text,
+    quarantined_at timestamp
+);
@@ -0,0 +1,18 @@
+CREATE TABLE users
+(
+    id            int PRIMARY KEY,
+    username      text      NOT NULL DEFAULT '',
+    language_code text      NOT NULL DEFAULT '',
+    timezone      text      NOT NULL DEFAULT '',
+    preferences   text      NOT NULL DEFAULT '',
+    is_blocked    boolean   NOT NULL DEFAULT false,
+    created_at    timestamp NOT NULL,
+    last_seen_at  timestamp NOT NULL
+);
+
+CREATE INDEX users_last_seen_at_idx ON users (last_seen_at);
+
+-- Users that subscribed before the table was added.
+INSERT INTO users (id, created_at, last_seen_at)
+SELECT DISTINCT user_id, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM subscriptions;
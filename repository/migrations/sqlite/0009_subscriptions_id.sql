@@ -0,0 +1,23 @@
+-- SQLite can not add primary key to existing table, so the table is rebuilt.
+-- AUTOINCREMENT prevents reuse of IDs of removed subscriptions,
+-- so stale references can not point to another subscription.
+CREATE TABLE subscriptions_new
+(
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    user_id    int,
+    app_name   text,
+    link       text,
+    is_active  boolean NOT NULL DEFAULT true,
+    created_at timestamp
+);
+
+INSERT INTO subscriptions_new (user_id, app_name, link, is_active, created_at)
+SELECT user_id, app_name, link, is_active, created_at
+FROM subscriptions
+ORDER BY rowid;
+
+DROP TABLE subscriptions;
+ALTER TABLE subscriptions_new RENAME TO subscriptions;
+
+CREATE UNIQUE INDEX subscriptions_user_id_link_idx ON subscriptions (user_id, link);
+CREATE INDEX subscriptions_link_idx ON subscriptions (link);
@@ -0,0 +1,589 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// pqUniqueViolation is code of unique_violation error.
+const pqUniqueViolation = "23505"
+
+// postgresRepo is postgres implementation of Repository
+type postgresRepo struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository returns new Repository instance.
+func NewPostgresRepository(dsn string) (Repository, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db connection: %w", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping db: %w", err)
+	}
+
+	return &postgresRepo{db: db}, nil
+}
+
+func (s *postgresRepo) SaveSubscription(sub Subscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `INSERT INTO subscriptions (user_id, app_name, link, created_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(query, sub.UserID, sub.AppName, sub.Link, nullTime(sub.CreatedAt))
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	if sub.LastStatus != "" {
+		err = savePostgresStatus(tx, sub)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) RemoveSubscription(sub Subscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `DELETE FROM subscriptions WHERE user_id = $1 AND link = $2`
+	res, err := tx.Exec(query, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	const statusQuery = `DELETE FROM subscription_states WHERE user_id = $1 AND link = $2`
+	_, err = tx.Exec(statusQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) UpdateSubscriptionLink(userID int, oldLink, newLink string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `UPDATE subscriptions SET link = $1 WHERE user_id = $2 AND link = $3`
+	res, err := tx.Exec(query, newLink, userID, oldLink)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	// status of the new link can only be left by removed subscription
+	const removeStatusQuery = `DELETE FROM subscription_states WHERE user_id = $1 AND link = $2`
+	_, err = tx.Exec(removeStatusQuery, userID, newLink)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`UPDATE subscription_states SET link = $1 WHERE user_id = $2 AND link = $3`,
+		`UPDATE outbox SET link = $1 WHERE user_id = $2 AND link = $3`,
+	} {
+		_, err = tx.Exec(query, newLink, userID, oldLink)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) GetSubscription(userID int, id int64) (Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.user_id = $1 AND s.id = $2`
+	rows, err := s.db.Query(query, userID, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	subs, err := scanSubscriptions(rows)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(subs) == 0 {
+		return Subscription{}, ErrNotFound
+	}
+
+	return subs[0], nil
+}
+
+func (s *postgresRepo) GetUserSubscriptions(userID int) ([]Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.user_id = $1`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+func (s *postgresRepo) GetLinkSubscriptions(link string) ([]Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.link = $1`
+	rows, err := s.db.Query(query, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+func (s *postgresRepo) GetAllSubscriptions() ([]Subscription, error) {
+	rows, err := s.db.Query(selectSubscriptionsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+func (s *postgresRepo) SaveSubscriptionStatus(sub Subscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	err = savePostgresStatus(tx, sub)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) SaveSubscriptionStatusWithNotification(sub Subscription, item OutboxItem) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	err = savePostgresStatus(tx, sub)
+	if err != nil {
+		return err
+	}
+
+	const query = `
+INSERT INTO outbox (user_id, link, event_type, status, state, created_at, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+	createdAt := item.CreatedAt.UTC()
+	_, err = tx.Exec(query, item.UserID, item.Link, item.EventType, item.Status, OutboxPending, createdAt, createdAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) GetPendingNotifications(now time.Time, limit int) ([]OutboxItem, error) {
+	const query = selectOutboxQuery + `
+WHERE state = $1
+  AND next_attempt_at <= $2
+ORDER BY id
+LIMIT $3
+`
+	rows, err := s.db.Query(query, OutboxPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutbox(rows)
+}
+
+func (s *postgresRepo) MarkNotificationDelivered(id int64, deliveredAt time.Time) error {
+	const query = `UPDATE outbox SET state = $1, attempts = attempts + 1, completed_at = $2 WHERE id = $3`
+	_, err := s.db.Exec(query, OutboxDelivered, deliveredAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) MarkNotificationDropped(id int64, reason string, droppedAt time.Time) error {
+	const query = `UPDATE outbox SET state = $1, last_error = $2, completed_at = $3 WHERE id = $4`
+	_, err := s.db.Exec(query, OutboxDropped, reason, droppedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) RetryNotification(id int64, notifierMask int64, lastError string, nextAttemptAt time.Time) error {
+	const query = `
+UPDATE outbox
+SET attempts        = attempts + 1,
+    notifier_mask   = $1,
+    last_error      = $2,
+    next_attempt_at = $3
+WHERE id = $4
+`
+	_, err := s.db.Exec(query, notifierMask, lastError, nextAttemptAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) RemoveCompletedNotifications(before time.Time) (int64, error) {
+	const query = `DELETE FROM outbox WHERE state <> $1 AND completed_at < $2`
+	res, err := s.db.Exec(query, OutboxPending, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *postgresRepo) UpdateAppName(link, appName string) error {
+	const query = `UPDATE subscriptions SET app_name = $1 WHERE link = $2`
+	_, err := s.db.Exec(query, appName, link)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) SaveBetaMetadata(link string, md BetaMetadata) error {
+	const query = `
+INSERT INTO betas (link, icon_url, description, platforms, developer, updated_at)
+VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+ON CONFLICT (link) DO UPDATE SET icon_url    = excluded.icon_url,
+                                 description = excluded.description,
+                                 platforms   = excluded.platforms,
+                                 developer   = excluded.developer,
+                                 updated_at  = excluded.updated_at;
+`
+	_, err := s.db.Exec(
+		query,
+		link,
+		md.IconURL,
+		md.Description,
+		joinPlatforms(md.Platforms),
+		md.Developer,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) SetUserSubscriptionsActive(userID int, isActive bool) (int64, error) {
+	const query = `UPDATE subscriptions SET is_active = $1 WHERE user_id = $2 AND is_active <> $1`
+	res, err := s.db.Exec(query, isActive, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *postgresRepo) QuarantineSubscription(sub Subscription, reason string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `
+INSERT INTO quarantined_subscriptions (user_id, app_name, link, reason, quarantined_at)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+`
+	_, err = tx.Exec(query, sub.UserID, sub.AppName, sub.Link, reason)
+	if err != nil {
+		return err
+	}
+
+	const deleteQuery = `DELETE FROM subscriptions WHERE user_id = $1 AND link = $2`
+	_, err = tx.Exec(deleteQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	const statusQuery = `DELETE FROM subscription_states WHERE user_id = $1 AND link = $2`
+	_, err = tx.Exec(statusQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) SaveBetaCheck(check BetaCheck) error {
+	const query = `
+INSERT INTO beta_checks (link, checked_at, status, status_code, latency_ms, error)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+	_, err := s.db.Exec(
+		query,
+		check.Link,
+		check.CheckedAt.UTC(),
+		check.Status,
+		check.StatusCode,
+		check.Latency.Milliseconds(),
+		check.Error,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error) {
+	const query = `
+SELECT link, checked_at, status, status_code, latency_ms, error
+FROM beta_checks
+WHERE link = $1
+  AND checked_at >= $2
+  AND checked_at < $3
+ORDER BY checked_at, id
+`
+	rows, err := s.db.Query(query, link, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanBetaChecks(rows)
+}
+
+func (s *postgresRepo) GetLastBetaCheck(link string) (BetaCheck, error) {
+	const query = `
+SELECT link, checked_at, status, status_code, latency_ms, error
+FROM beta_checks
+WHERE link = $1
+ORDER BY checked_at DESC, id DESC
+LIMIT 1
+`
+	rows, err := s.db.Query(query, link)
+	if err != nil {
+		return BetaCheck{}, err
+	}
+
+	checks, err := scanBetaChecks(rows)
+	if err != nil {
+		return BetaCheck{}, err
+	}
+	if len(checks) == 0 {
+		return BetaCheck{}, ErrBetaCheckNotFound
+	}
+
+	return checks[0], nil
+}
+
+func (s *postgresRepo) RemoveBetaChecks(before time.Time) (int64, error) {
+	const query = `DELETE FROM beta_checks WHERE checked_at < $1`
+	res, err := s.db.Exec(query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *postgresRepo) DownsampleBetaChecks(before time.Time, interval time.Duration) (int64, error) {
+	seconds, err := intervalSeconds(interval)
+	if err != nil {
+		return 0, err
+	}
+
+	const query = `
+DELETE
+FROM beta_checks
+WHERE checked_at < $1
+  AND id NOT IN (SELECT MIN(id)
+                 FROM beta_checks
+                 WHERE checked_at < $1
+                 GROUP BY link, status, FLOOR(EXTRACT(EPOCH FROM checked_at) / $2))
+`
+	res, err := s.db.Exec(query, before.UTC(), seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *postgresRepo) SaveUser(user User) error {
+	const query = `
+INSERT INTO users (id, username, language_code, is_blocked, created_at, last_seen_at)
+VALUES ($1, $2, $3, false, $4, $5)
+ON CONFLICT (id) DO UPDATE SET username      = excluded.username,
+                               language_code = excluded.language_code,
+                               last_seen_at  = excluded.last_seen_at;
+`
+	lastSeenAt := user.LastSeenAt.UTC()
+	_, err := s.db.Exec(query, user.ID, user.Username, user.LanguageCode, lastSeenAt, lastSeenAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresRepo) GetUser(userID int) (User, error) {
+	const query = selectUsersQuery + `WHERE id = $1`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	users, err := scanUsers(rows)
+	if err != nil {
+		return User{}, err
+	}
+	if len(users) == 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	return users[0], nil
+}
+
+func (s *postgresRepo) GetUsersSeenBefore(t time.Time) ([]User, error) {
+	const query = selectUsersQuery + `WHERE last_seen_at < $1 ORDER BY last_seen_at`
+	rows, err := s.db.Query(query, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanUsers(rows)
+}
+
+func (s *postgresRepo) SetUserBlocked(userID int, isBlocked bool) error {
+	const query = `UPDATE users SET is_blocked = $1 WHERE id = $2`
+	res, err := s.db.Exec(query, isBlocked, userID)
+	if err != nil {
+		return err
+	}
+
+	return checkUserAffected(res)
+}
+
+func (s *postgresRepo) SaveUserPreferences(userID int, timezone string, preferences []byte) error {
+	const query = `UPDATE users SET timezone = $1, preferences = $2 WHERE id = $3`
+	res, err := s.db.Exec(query, timezone, string(preferences), userID)
+	if err != nil {
+		return err
+	}
+
+	return checkUserAffected(res)
+}
+
+func (s *postgresRepo) RemoveUserData(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	for _, query := range []string{
+		`DELETE FROM subscriptions WHERE user_id = $1`,
+		`DELETE FROM subscription_states WHERE user_id = $1`,
+		`DELETE FROM quarantined_subscriptions WHERE user_id = $1`,
+		`DELETE FROM outbox WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	} {
+		_, err = tx.Exec(query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresRepo) Close() error {
+	return s.db.Close()
+}
+
+// savePostgresStatus saves status of subscription in the transaction.
+// Row of subscription is locked first, so subscription
+// can not be removed until the transaction is finished.
+// ErrNotFound is returned if subscription does not exist.
+func savePostgresStatus(tx *sql.Tx, sub Subscription) error {
+	const lockQuery = `SELECT 1 FROM subscriptions WHERE user_id = $1 AND link = $2 FOR SHARE`
+	var exists int
+	err := tx.QueryRow(lockQuery, sub.UserID, sub.Link).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	const query = `
+INSERT INTO subscription_states (user_id, link, status, updated_at)
+VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id, link) DO UPDATE SET status     = excluded.status,
+                                          updated_at = excluded.updated_at;
+`
+	_, err = tx.Exec(query, sub.UserID, sub.Link, sub.LastStatus)
+	return err
+}
+
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
@@ -1,22 +1,278 @@
 package repository
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Supported database drivers.
+const (
+	DriverSqlite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var (
+	// ErrAlreadyExists is error that will be returned
+	// if saved subscription already exists.
+	ErrAlreadyExists = errors.New("subscription already exists")
+
+	// ErrNotFound is error that will be returned
+	// if removed subscription does not exist.
+	ErrNotFound = errors.New("subscription not found")
+
+	// ErrBetaCheckNotFound is error that will be returned
+	// if beta has not been checked yet.
+	ErrBetaCheckNotFound = errors.New("beta check not found")
+
+	// ErrUserNotFound is error that will be returned
+	// if user does not exist.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrUnknownDriver is error that will be returned
+	// if database driver is not supported.
+	ErrUnknownDriver = errors.New("unknown database driver")
+)
+
+// New returns Repository instance of the driver.
+// ErrUnknownDriver is returned if driver is not supported.
+func New(driver, dsn string) (Repository, error) {
+	switch driver {
+	case DriverSqlite:
+		return NewSqliteRepository(dsn)
+	case DriverPostgres:
+		return NewPostgresRepository(dsn)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, driver)
+	}
+}
 
 // Repository describes a storage
 // to save user subscriptions.
 type Repository interface {
+	// SaveSubscription saves new active subscription.
+	// New ID is assigned to the subscription, ID of sub is ignored.
+	// Last status is saved along with the subscription if it is set,
+	// e.g. when removed subscription is restored.
+	// ErrAlreadyExists is returned if user already subscribed the link.
 	SaveSubscription(sub Subscription) error
+	// RemoveSubscription removes subscription along with its status.
+	// ErrNotFound is returned if user did not subscribe the link.
 	RemoveSubscription(sub Subscription) error
+	// UpdateSubscriptionLink changes link of subscription of the user
+	// in one transaction. ID, status and other fields of subscription are kept.
+	// ErrNotFound is returned if user did not subscribe oldLink,
+	// ErrAlreadyExists is returned if user already subscribed newLink.
+	UpdateSubscriptionLink(userID int, oldLink, newLink string) error
+	// GetSubscription returns subscription of the user by its ID.
+	// ErrNotFound is returned if user has no subscription with the ID.
+	GetSubscription(userID int, id int64) (Subscription, error)
 	GetUserSubscriptions(userID int) ([]Subscription, error)
+	GetLinkSubscriptions(link string) ([]Subscription, error)
 	GetAllSubscriptions() ([]Subscription, error)
-	DeleteAllSubscriptions() error
+
+	// SaveSubscriptionStatus saves last known status of subscription.
+	// ErrNotFound is returned if user did not subscribe the link,
+	// e.g. subscription is removed while the beta is checked,
+	// so status is never left without subscription.
+	SaveSubscriptionStatus(sub Subscription) error
+	// SaveSubscriptionStatusWithNotification saves last known status of subscription
+	// and adds pending notification to outbox in one transaction,
+	// so notification is not lost if process stops before it is sent.
+	// ErrNotFound is returned if user did not subscribe the link,
+	// nothing is saved then.
+	SaveSubscriptionStatusWithNotification(sub Subscription, item OutboxItem) error
+	// UpdateAppName renames app of all subscriptions to the link.
+	UpdateAppName(link, appName string) error
+	// SaveBetaMetadata saves metadata of the beta app.
+	SaveBetaMetadata(link string, md BetaMetadata) error
+	// SetUserSubscriptionsActive activates or deactivates
+	// all subscriptions of the user.
+	// It returns count of subscriptions that are changed.
+	SetUserSubscriptionsActive(userID int, isActive bool) (int64, error)
+	// QuarantineSubscription moves broken subscription out of subscriptions,
+	// so it is kept for investigation but is not restored anymore.
+	// Status of the subscription is removed.
+	QuarantineSubscription(sub Subscription, reason string) error
+
+	// SaveBetaCheck saves result of beta check to history.
+	SaveBetaCheck(check BetaCheck) error
+	// GetBetaChecks returns checks of the link
+	// made in [from, to) ordered by time.
+	GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error)
+	// GetLastBetaCheck returns the latest check of the link.
+	// ErrBetaCheckNotFound is returned if link has not been checked yet.
+	GetLastBetaCheck(link string) (BetaCheck, error)
+	// RemoveBetaChecks removes checks made before the time.
+	// It returns count of removed checks.
+	RemoveBetaChecks(before time.Time) (int64, error)
+	// DownsampleBetaChecks thins out checks made before the time.
+	// Only the first check of each status is kept
+	// per link in every interval since Unix epoch.
+	// It returns count of removed checks.
+	DownsampleBetaChecks(before time.Time, interval time.Duration) (int64, error)
+
+	// GetPendingNotifications returns up to limit pending notifications
+	// whose next attempt is due at the time ordered by ID.
+	GetPendingNotifications(now time.Time, limit int) ([]OutboxItem, error)
+	// MarkNotificationDelivered marks notification as delivered.
+	MarkNotificationDelivered(id int64, deliveredAt time.Time) error
+	// MarkNotificationDropped marks notification that will not be delivered.
+	MarkNotificationDropped(id int64, reason string, droppedAt time.Time) error
+	// RetryNotification schedules the next attempt to deliver notification
+	// and saves notifiers that have already received it.
+	RetryNotification(id int64, notifierMask int64, lastError string, nextAttemptAt time.Time) error
+	// RemoveCompletedNotifications removes delivered and dropped notifications
+	// that were completed before the time.
+	// It returns count of removed notifications.
+	RemoveCompletedNotifications(before time.Time) (int64, error)
+
+	// SaveUser saves profile of the user that was seen at LastSeenAt.
+	// New user is created at that time and is not blocked.
+	// Blocked mark, timezone and preferences of existing user are kept:
+	// the mark is cleared by SetUserBlocked along with reactivation
+	// of subscriptions, so it never disagrees with them.
+	SaveUser(user User) error
+	// GetUser returns user.
+	// ErrUserNotFound is returned if user does not exist.
+	GetUser(userID int) (User, error)
+	// GetUsersSeenBefore returns users that were last seen before the time.
+	GetUsersSeenBefore(t time.Time) ([]User, error)
+	// SetUserBlocked marks whether user has blocked the bot.
+	// ErrUserNotFound is returned if user does not exist.
+	SetUserBlocked(userID int, isBlocked bool) error
+	// SaveUserPreferences saves timezone and preferences of the user.
+	// ErrUserNotFound is returned if user does not exist.
+	SaveUserPreferences(userID int, timezone string, preferences []byte) error
+	// RemoveUserData removes the user and every row tied to the user:
+	// subscriptions, their statuses, quarantined subscriptions and notifications.
+	// History of beta checks is kept, since it is shared by all subscribers.
+	RemoveUserData(userID int) error
 
 	io.Closer
 }
 
 // Subscription describes user subscription.
 type Subscription struct {
+	// ID is stable identifier of subscription assigned by repository.
+	// It is never reused after subscription is removed.
+	ID      int64
 	UserID  int
 	Link    string
 	AppName string
+
+	// LastStatus is last known status of the beta.
+	// It is empty if beta has not been checked yet.
+	LastStatus string
+	// Metadata is metadata of the beta app.
+	// It is shared by all subscriptions to the link.
+	Metadata BetaMetadata
+	// Inactive is whether subscription is deactivated,
+	// e.g. because user has blocked the bot.
+	// Inactive subscriptions are not checked.
+	Inactive bool
+	// CreatedAt is time when user subscribed the beta.
+	// It is zero if the time is unknown.
+	CreatedAt time.Time
+}
+
+// BetaMetadata describes beta app.
+type BetaMetadata struct {
+	IconURL     string
+	Description string
+	Platforms   []string
+	Developer   string
+}
+
+// States of outbox items.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDropped   = "dropped"
+)
+
+// OutboxItem is notification waiting to be delivered.
+type OutboxItem struct {
+	ID     int64
+	UserID int
+	Link   string
+	// EventType is type of service event.
+	EventType int
+	// Status is status of the beta that notification is about.
+	Status string
+
+	// State is one of OutboxPending, OutboxDelivered or OutboxDropped.
+	State    string
+	Attempts int
+	// NotifierMask is bitmask of notifiers that have already received
+	// notification, bit i is set for notifier registered i-th,
+	// so they do not receive it again when delivery is retried.
+	NotifierMask int64
+	// LastError is error of the last failed attempt
+	// or reason why notification is dropped.
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	// CompletedAt is time when notification was delivered or dropped.
+	// It is zero for pending notifications.
+	CompletedAt time.Time
+}
+
+// User describes Telegram user of the bot.
+type User struct {
+	ID           int
+	Username     string
+	LanguageCode string
+	// Timezone is IANA timezone of the user.
+	// It is empty if user has not set it.
+	Timezone string
+	// Preferences is JSON encoded preferences of the user.
+	// It is empty if user has not set any.
+	Preferences []byte
+	// IsBlocked is whether user has blocked the bot.
+	IsBlocked  bool
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// BetaCheck describes result of beta check.
+type BetaCheck struct {
+	Link      string
+	CheckedAt time.Time
+	// Status is status of the beta.
+	// It is unknown if check is failed.
+	Status string
+	// StatusCode is HTTP status of TestFlight page.
+	// It is zero if page is not received.
+	StatusCode int
+	Latency    time.Duration
+	// Error is error text of failed check.
+	Error string
+}
+
+// intervalSeconds returns downsampling interval in whole seconds.
+func intervalSeconds(interval time.Duration) (int64, error) {
+	seconds := int64(interval / time.Second)
+	if seconds <= 0 {
+		return 0, fmt.Errorf("invalid downsampling interval %s", interval)
+	}
+
+	return seconds, nil
+}
+
+// platformsSep separates platforms in storage.
+const platformsSep = ","
+
+func joinPlatforms(platforms []string) string {
+	return strings.Join(platforms, platformsSep)
+}
+
+func splitPlatforms(platforms string) []string {
+	if platforms == "" {
+		return nil
+	}
+
+	return strings.Split(platforms, platformsSep)
 }
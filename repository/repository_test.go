@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/repository/repotest"
+)
+
+// postgresDSNEnv is environment variable with connection string
+// of postgres database that is used by tests. Tests of postgres
+// are skipped if it is empty. All data of the database is removed.
+const postgresDSNEnv = "TFDOG_TEST_POSTGRES_DSN"
+
+func TestSqliteRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		dsn := filepath.Join(t.TempDir(), "tfdog.db")
+		return newMigratedRepository(t, repository.DriverSqlite, dsn)
+	})
+}
+
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		repo := newMigratedRepository(t, repository.DriverPostgres, dsn)
+		cleanPostgres(t, dsn)
+		return repo
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		repo := repository.NewMemoryRepository()
+		t.Cleanup(func() {
+			_ = repo.Close()
+		})
+		return repo
+	})
+}
+
+// newMigratedRepository returns repository of migrated database
+// that is closed when the test is finished.
+func newMigratedRepository(t *testing.T, driver, dsn string) repository.Repository {
+	t.Helper()
+
+	m, err := repository.NewMigrator(driver, dsn)
+	if err != nil {
+		t.Fatalf("failed to create migrator: %v", err)
+	}
+	defer func(m *repository.Migrator) {
+		_ = m.Close()
+	}(m)
+
+	_, err = m.Up()
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	repo, err := repository.New(driver, dsn)
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = repo.Close()
+	})
+
+	return repo
+}
+
+// cleanPostgres removes data that is left by previous tests.
+func cleanPostgres(t *testing.T, dsn string) {
+	t.Helper()
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open db connection: %v", err)
+	}
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	const query = `TRUNCATE subscriptions, subscription_states, betas, quarantined_subscriptions, beta_checks, users, outbox`
+	_, err = db.Exec(query)
+	if err != nil {
+		t.Fatalf("failed to clean database: %v", err)
+	}
+}
@@ -0,0 +1,1099 @@
+// Package repotest contains conformance tests
+// that every implementation of repository.Repository must pass.
+package repotest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/repository"
+)
+
+// Run runs conformance tests against repositories returned by newRepo.
+// Every call of newRepo must return repository without subscriptions
+// and close it in cleanup of t.
+func Run(t *testing.T, newRepo func(t *testing.T) repository.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo repository.Repository)
+	}{
+		{"SaveSubscription", testSaveSubscription},
+		{"SaveSubscriptionDedup", testSaveSubscriptionDedup},
+		{"RemoveSubscription", testRemoveSubscription},
+		{"RemoveUserSubscription", testRemoveUserSubscription},
+		{"GetSubscriptions", testGetSubscriptions},
+		{"GetSubscription", testGetSubscription},
+		{"UpdateSubscriptionLink", testUpdateSubscriptionLink},
+		{"SaveSubscriptionStatus", testSaveSubscriptionStatus},
+		{"UpdateAppName", testUpdateAppName},
+		{"SaveBetaMetadata", testSaveBetaMetadata},
+		{"SetUserSubscriptionsActive", testSetUserSubscriptionsActive},
+		{"QuarantineSubscription", testQuarantineSubscription},
+		{"GetBetaChecks", testGetBetaChecks},
+		{"GetLastBetaCheck", testGetLastBetaCheck},
+		{"RemoveBetaChecks", testRemoveBetaChecks},
+		{"DownsampleBetaChecks", testDownsampleBetaChecks},
+		{"Outbox", testOutbox},
+		{"RemoveCompletedNotifications", testRemoveCompletedNotifications},
+		{"SaveUser", testSaveUser},
+		{"GetUsersSeenBefore", testGetUsersSeenBefore},
+		{"UserNotFound", testUserNotFound},
+		{"RemoveUserData", testRemoveUserData},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+func mustSave(t *testing.T, repo repository.Repository, subs ...repository.Subscription) {
+	t.Helper()
+
+	for _, sub := range subs {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatalf("failed to save subscription: %v", err)
+		}
+	}
+}
+
+func sortSubscriptions(subs []repository.Subscription) {
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].UserID != subs[j].UserID {
+			return subs[i].UserID < subs[j].UserID
+		}
+		return subs[i].Link < subs[j].Link
+	})
+}
+
+// withoutIDs zeroes IDs assigned by repository,
+// so subscriptions can be compared with saved ones.
+func withoutIDs(subs []repository.Subscription) []repository.Subscription {
+	for i := range subs {
+		subs[i].ID = 0
+	}
+
+	return subs
+}
+
+func testSaveSubscription(t *testing.T, repo repository.Repository) {
+	sub := repository.Subscription{UserID: 1, Link: "https://testflight.apple.com/join/abc", AppName: "App"}
+	mustSave(t, repo, sub)
+
+	err := repo.SaveSubscription(sub)
+	if !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("expected repository.ErrAlreadyExists, got %v", err)
+	}
+
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(withoutIDs(subs), []repository.Subscription{sub}) {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// removed subscription is saved again with its status
+	restored := repository.Subscription{
+		UserID:     2,
+		Link:       sub.Link,
+		AppName:    "App",
+		LastStatus: "open",
+		CreatedAt:  time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC),
+	}
+	mustSave(t, repo, restored)
+
+	subs, err = repo.GetUserSubscriptions(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(withoutIDs(subs), []repository.Subscription{restored}) {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testSaveSubscriptionDedup(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	mustSave(t, repo,
+		repository.Subscription{UserID: 1, Link: link, AppName: "App"},
+		repository.Subscription{UserID: 2, Link: link, AppName: "App"},
+	)
+
+	// the same link is saved once per user, even with another app name
+	for _, userID := range []int{1, 2} {
+		err := repo.SaveSubscription(repository.Subscription{UserID: userID, Link: link, AppName: "Other"})
+		if !errors.Is(err, repository.ErrAlreadyExists) {
+			t.Fatalf("expected ErrAlreadyExists, got %v", err)
+		}
+	}
+
+	subs, err := repo.GetLinkSubscriptions(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testRemoveSubscription(t *testing.T, repo repository.Repository) {
+	sub := repository.Subscription{UserID: 1, Link: "https://testflight.apple.com/join/abc", AppName: "App"}
+	mustSave(t, repo, sub)
+
+	sub.LastStatus = "open"
+	err := repo.SaveSubscriptionStatus(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RemoveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RemoveSubscription(sub)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+
+	err = repo.RemoveSubscription(repository.Subscription{UserID: 2, Link: sub.Link})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another user, got %v", err)
+	}
+
+	// status must be removed along with subscription
+	sub.LastStatus = ""
+	mustSave(t, repo, sub)
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testGetSubscriptions(t *testing.T, repo repository.Repository) {
+	const (
+		linkA = "https://testflight.apple.com/join/a"
+		linkB = "https://testflight.apple.com/join/b"
+	)
+	subs := []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A", CreatedAt: time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{UserID: 1, Link: linkB, AppName: "B"},
+		{UserID: 2, Link: linkA, AppName: "A"},
+	}
+	mustSave(t, repo, subs...)
+
+	all, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(all)
+	if !reflect.DeepEqual(withoutIDs(all), subs) {
+		t.Fatalf("unexpected all subscriptions: %+v", all)
+	}
+
+	user, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(user)
+	if !reflect.DeepEqual(withoutIDs(user), subs[:2]) {
+		t.Fatalf("unexpected user subscriptions: %+v", user)
+	}
+
+	link, err := repo.GetLinkSubscriptions(linkA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(link)
+	if !reflect.DeepEqual(withoutIDs(link), []repository.Subscription{subs[0], subs[2]}) {
+		t.Fatalf("unexpected link subscriptions: %+v", link)
+	}
+
+	none, err := repo.GetUserSubscriptions(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 0 {
+		t.Fatalf("unexpected subscriptions: %+v", none)
+	}
+}
+
+func testGetSubscription(t *testing.T, repo repository.Repository) {
+	const (
+		linkA = "https://testflight.apple.com/join/a"
+		linkB = "https://testflight.apple.com/join/b"
+	)
+	mustSave(t, repo,
+		repository.Subscription{UserID: 1, Link: linkA, AppName: "A"},
+		repository.Subscription{UserID: 1, Link: linkB, AppName: "B"},
+	)
+
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 || subs[0].ID == 0 || subs[0].ID == subs[1].ID {
+		t.Fatalf("unexpected IDs of subscriptions: %+v", subs)
+	}
+
+	for _, sub := range subs {
+		res, err := repo.GetSubscription(1, sub.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, sub) {
+			t.Fatalf("unexpected subscription: %+v", res)
+		}
+	}
+
+	// subscription of another user is not found by ID
+	_, err = repo.GetSubscription(2, subs[0].ID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+
+	// ID of removed subscription is not reused
+	last := subs[0]
+	if subs[1].ID > last.ID {
+		last = subs[1]
+	}
+	err = repo.RemoveSubscription(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetSubscription(1, last.ID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+
+	mustSave(t, repo, repository.Subscription{UserID: 1, Link: last.Link, AppName: last.AppName})
+	subs, err = repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range subs {
+		if sub.Link == last.Link && sub.ID <= last.ID {
+			t.Fatalf("ID of removed subscription is reused: %+v", sub)
+		}
+	}
+}
+
+func testUpdateSubscriptionLink(t *testing.T, repo repository.Repository) {
+	const (
+		oldLink   = "http://testflight.apple.com/join/abc"
+		newLink   = "https://testflight.apple.com/join/abc"
+		otherLink = "https://testflight.apple.com/join/other"
+	)
+	mustSave(t, repo,
+		repository.Subscription{
+			UserID:    1,
+			Link:      oldLink,
+			AppName:   "App",
+			CreatedAt: time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		repository.Subscription{UserID: 1, Link: otherLink, AppName: "Other"},
+	)
+	err := repo.SaveSubscriptionStatus(repository.Subscription{UserID: 1, Link: oldLink, LastStatus: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.SetUserSubscriptionsActive(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(before)
+
+	err = repo.UpdateSubscriptionLink(1, oldLink, newLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ID, status, time and flags are kept
+	expected := before[0]
+	expected.Link = newLink
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(subs)
+	if len(subs) != 2 || !reflect.DeepEqual(subs[0], expected) || !reflect.DeepEqual(subs[1], before[1]) {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	err = repo.UpdateSubscriptionLink(1, oldLink, newLink)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+
+	err = repo.UpdateSubscriptionLink(1, otherLink, newLink)
+	if !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("expected repository.ErrAlreadyExists, got %v", err)
+	}
+
+	// failed update changes nothing
+	subs, err = repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortSubscriptions(subs)
+	if len(subs) != 2 || !reflect.DeepEqual(subs[0], expected) || !reflect.DeepEqual(subs[1], before[1]) {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testSaveSubscriptionStatus(t *testing.T, repo repository.Repository) {
+	sub := repository.Subscription{UserID: 1, Link: "https://testflight.apple.com/join/abc", AppName: "App"}
+	mustSave(t, repo, sub)
+
+	for _, status := range []string{"full", "open"} {
+		sub.LastStatus = status
+		err := repo.SaveSubscriptionStatus(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subs, err := repo.GetLinkSubscriptions(sub.Link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subs) != 1 || subs[0].LastStatus != status {
+			t.Fatalf("unexpected subscriptions: %+v", subs)
+		}
+	}
+
+	// status of removed subscription is not saved,
+	// so it does not affect the next subscription to the link
+	err := repo.RemoveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveSubscriptionStatus(sub)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+
+	sub.LastStatus = ""
+	mustSave(t, repo, sub)
+	subs, err := repo.GetLinkSubscriptions(sub.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testUpdateAppName(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	mustSave(t, repo,
+		repository.Subscription{UserID: 1, Link: link, AppName: "Unknown app"},
+		repository.Subscription{UserID: 2, Link: link, AppName: "Unknown app"},
+	)
+
+	err := repo.UpdateAppName(link, "App")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := repo.GetLinkSubscriptions(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+	for _, sub := range subs {
+		if sub.AppName != "App" {
+			t.Fatalf("app name is not updated: %+v", sub)
+		}
+	}
+}
+
+func testSaveBetaMetadata(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	mustSave(t, repo, repository.Subscription{UserID: 1, Link: link, AppName: "App"})
+
+	for _, md := range []repository.BetaMetadata{
+		{
+			IconURL:     "https://example.com/icon.png",
+			Description: "description",
+			Platforms:   []string{"iOS", "macOS"},
+			Developer:   "developer",
+		},
+		{
+			Description: "new description",
+			Platforms:   []string{"iOS"},
+		},
+	} {
+		err := repo.SaveBetaMetadata(link, md)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subs, err := repo.GetUserSubscriptions(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subs) != 1 || !reflect.DeepEqual(subs[0].Metadata, md) {
+			t.Fatalf("unexpected subscriptions: %+v", subs)
+		}
+	}
+}
+
+func testQuarantineSubscription(t *testing.T, repo repository.Repository) {
+	sub := repository.Subscription{UserID: 1, Link: "https://testflight.apple.com/join/abc", AppName: "App"}
+	mustSave(t, repo, sub)
+
+	sub.LastStatus = "open"
+	err := repo.SaveSubscriptionStatus(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.QuarantineSubscription(sub, "broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := repo.GetAllSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// status must be removed along with subscription
+	sub.LastStatus = ""
+	mustSave(t, repo, sub)
+	subs, err = repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testRemoveUserSubscription(t *testing.T, repo repository.Repository) {
+	const (
+		linkA = "https://testflight.apple.com/join/a"
+		linkB = "https://testflight.apple.com/join/b"
+	)
+	mustSave(t, repo,
+		repository.Subscription{UserID: 1, Link: linkA, AppName: "A"},
+		repository.Subscription{UserID: 1, Link: linkB, AppName: "B"},
+		repository.Subscription{UserID: 2, Link: linkA, AppName: "A"},
+	)
+
+	err := repo.RemoveSubscription(repository.Subscription{UserID: 1, Link: linkA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only subscription of the user to the link is removed
+	user, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user) != 1 || user[0].Link != linkB {
+		t.Fatalf("unexpected user subscriptions: %+v", user)
+	}
+
+	link, err := repo.GetLinkSubscriptions(linkA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(link) != 1 || link[0].UserID != 2 {
+		t.Fatalf("unexpected link subscriptions: %+v", link)
+	}
+}
+
+// checksStart is time of the first saved check.
+// It is aligned to hour to make downsampling predictable.
+var checksStart = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func mustSaveChecks(t *testing.T, repo repository.Repository, checks ...repository.BetaCheck) {
+	t.Helper()
+
+	for _, check := range checks {
+		err := repo.SaveBetaCheck(check)
+		if err != nil {
+			t.Fatalf("failed to save beta check: %v", err)
+		}
+	}
+}
+
+func mustGetChecks(t *testing.T, repo repository.Repository, link string) []repository.BetaCheck {
+	t.Helper()
+
+	checks, err := repo.GetBetaChecks(link, checksStart.Add(-time.Hour), checksStart.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to get beta checks: %v", err)
+	}
+
+	return checks
+}
+
+func testGetBetaChecks(t *testing.T, repo repository.Repository) {
+	const (
+		linkA = "https://testflight.apple.com/join/a"
+		linkB = "https://testflight.apple.com/join/b"
+	)
+	checks := []repository.BetaCheck{
+		{
+			Link:       linkA,
+			CheckedAt:  checksStart,
+			Status:     "full",
+			StatusCode: 200,
+			Latency:    150 * time.Millisecond,
+		},
+		{
+			Link:      linkA,
+			CheckedAt: checksStart.Add(2 * time.Minute),
+			Status:    "unknown",
+			Latency:   10 * time.Second,
+			Error:     "context deadline exceeded",
+		},
+		{
+			Link:       linkA,
+			CheckedAt:  checksStart.Add(time.Minute),
+			Status:     "open",
+			StatusCode: 200,
+			Latency:    time.Second,
+		},
+		{
+			Link:       linkB,
+			CheckedAt:  checksStart,
+			Status:     "closed",
+			StatusCode: 404,
+		},
+	}
+	mustSaveChecks(t, repo, checks...)
+
+	// checks are ordered by time, time range is half-open
+	res, err := repo.GetBetaChecks(linkA, checksStart, checksStart.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []repository.BetaCheck{checks[0], checks[2]}) {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+
+	res = mustGetChecks(t, repo, linkB)
+	if !reflect.DeepEqual(res, checks[3:]) {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+
+	res = mustGetChecks(t, repo, "https://testflight.apple.com/join/c")
+	if len(res) != 0 {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+}
+
+func testGetLastBetaCheck(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/a"
+
+	_, err := repo.GetLastBetaCheck(link)
+	if !errors.Is(err, repository.ErrBetaCheckNotFound) {
+		t.Fatalf("expected repository.ErrBetaCheckNotFound, got %v", err)
+	}
+
+	checks := []repository.BetaCheck{
+		{Link: link, CheckedAt: checksStart.Add(time.Minute), Status: "open", StatusCode: 200},
+		{Link: link, CheckedAt: checksStart, Status: "full", StatusCode: 200},
+		{Link: "https://testflight.apple.com/join/b", CheckedAt: checksStart.Add(time.Hour), Status: "full"},
+	}
+	mustSaveChecks(t, repo, checks...)
+
+	check, err := repo.GetLastBetaCheck(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(check, checks[0]) {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+}
+
+func testRemoveBetaChecks(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	for i := 0; i < 3; i++ {
+		mustSaveChecks(t, repo, repository.BetaCheck{
+			Link:      link,
+			CheckedAt: checksStart.Add(time.Duration(i) * time.Hour),
+			Status:    "full",
+		})
+	}
+
+	removed, err := repo.RemoveBetaChecks(checksStart.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed check, got %d", removed)
+	}
+
+	res := mustGetChecks(t, repo, link)
+	if len(res) != 2 || !res[0].CheckedAt.Equal(checksStart.Add(time.Hour)) {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+}
+
+func testDownsampleBetaChecks(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	statuses := []string{"full", "full", "open", "full", "open", "full"}
+	for hour := 0; hour < 3; hour++ {
+		for i, status := range statuses {
+			mustSaveChecks(t, repo, repository.BetaCheck{
+				Link:      link,
+				CheckedAt: checksStart.Add(time.Duration(hour)*time.Hour + time.Duration(i)*time.Minute),
+				Status:    status,
+			})
+		}
+	}
+
+	// the first check of each status is kept per hour
+	// in the first two hours, the last hour is untouched
+	removed, err := repo.DownsampleBetaChecks(checksStart.Add(2*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 8 {
+		t.Fatalf("expected 8 removed checks, got %d", removed)
+	}
+
+	res := mustGetChecks(t, repo, link)
+	var expected []time.Time
+	for hour := 0; hour < 2; hour++ {
+		expected = append(expected,
+			checksStart.Add(time.Duration(hour)*time.Hour),
+			checksStart.Add(time.Duration(hour)*time.Hour+2*time.Minute),
+		)
+	}
+	for i := range statuses {
+		expected = append(expected, checksStart.Add(2*time.Hour+time.Duration(i)*time.Minute))
+	}
+	if len(res) != len(expected) {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+	for i := range res {
+		if !res[i].CheckedAt.Equal(expected[i]) {
+			t.Fatalf("unexpected check %d: %+v", i, res[i])
+		}
+	}
+
+	_, err = repo.DownsampleBetaChecks(checksStart, 0)
+	if err == nil {
+		t.Fatal("expected error for zero interval")
+	}
+}
+
+func mustGetUser(t *testing.T, repo repository.Repository, userID int) repository.User {
+	t.Helper()
+
+	user, err := repo.GetUser(userID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+
+	return user
+}
+
+func testSaveUser(t *testing.T, repo repository.Repository) {
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := repo.SaveUser(repository.User{
+		ID:           1,
+		Username:     "john",
+		LanguageCode: "en",
+		LastSeenAt:   createdAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := repository.User{
+		ID:           1,
+		Username:     "john",
+		LanguageCode: "en",
+		CreatedAt:    createdAt,
+		LastSeenAt:   createdAt,
+	}
+	if user := mustGetUser(t, repo, 1); !reflect.DeepEqual(user, expected) {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	err = repo.SetUserBlocked(1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveUserPreferences(1, "Europe/Berlin", []byte(`{"quiet_hours":"23-8"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected.IsBlocked = true
+	expected.Timezone = "Europe/Berlin"
+	expected.Preferences = []byte(`{"quiet_hours":"23-8"}`)
+	if user := mustGetUser(t, repo, 1); !reflect.DeepEqual(user, expected) {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	// profile is updated by interaction, settings and blocked mark are kept
+	lastSeenAt := createdAt.Add(time.Hour)
+	err = repo.SaveUser(repository.User{
+		ID:           1,
+		Username:     "johnny",
+		LanguageCode: "de",
+		Timezone:     "UTC",
+		LastSeenAt:   lastSeenAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected.Username = "johnny"
+	expected.LanguageCode = "de"
+	expected.LastSeenAt = lastSeenAt
+	if user := mustGetUser(t, repo, 1); !reflect.DeepEqual(user, expected) {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	err = repo.SetUserBlocked(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected.IsBlocked = false
+	if user := mustGetUser(t, repo, 1); !reflect.DeepEqual(user, expected) {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+}
+
+func testGetUsersSeenBefore(t *testing.T, repo repository.Repository) {
+	seenAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, userID := range []int{3, 1, 2} {
+		err := repo.SaveUser(repository.User{
+			ID:         userID,
+			LastSeenAt: seenAt.Add(time.Duration(userID) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users, err := repo.GetUsersSeenBefore(seenAt.Add(3 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 1 || users[1].ID != 2 {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+}
+
+func testUserNotFound(t *testing.T, repo repository.Repository) {
+	_, err := repo.GetUser(1)
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	err = repo.SetUserBlocked(1, true)
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	err = repo.SaveUserPreferences(1, "UTC", nil)
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func testSetUserSubscriptionsActive(t *testing.T, repo repository.Repository) {
+	const (
+		linkA = "https://testflight.apple.com/join/a"
+		linkB = "https://testflight.apple.com/join/b"
+	)
+	mustSave(t, repo,
+		repository.Subscription{UserID: 1, Link: linkA, AppName: "A"},
+		repository.Subscription{UserID: 1, Link: linkB, AppName: "B"},
+		repository.Subscription{UserID: 2, Link: linkA, AppName: "A"},
+	)
+
+	for _, tt := range []struct {
+		isActive bool
+		changed  int64
+	}{
+		{isActive: false, changed: 2},
+		{isActive: false, changed: 0},
+		{isActive: true, changed: 2},
+	} {
+		changed, err := repo.SetUserSubscriptionsActive(1, tt.isActive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tt.changed {
+			t.Fatalf("expected %d changed subscriptions, got %d", tt.changed, changed)
+		}
+
+		subs, err := repo.GetAllSubscriptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			isActive := sub.UserID != 1 || tt.isActive
+			if sub.Inactive == isActive {
+				t.Fatalf("unexpected subscription: %+v", sub)
+			}
+		}
+	}
+}
+
+func mustEnqueue(t *testing.T, repo repository.Repository, createdAt time.Time, userIDs ...int) {
+	t.Helper()
+
+	const link = "https://testflight.apple.com/join/abc"
+	for _, userID := range userIDs {
+		// status is saved only for existing subscription
+		err := repo.SaveSubscription(repository.Subscription{UserID: userID, Link: link, AppName: "App"})
+		if err != nil && !errors.Is(err, repository.ErrAlreadyExists) {
+			t.Fatalf("failed to save subscription: %v", err)
+		}
+
+		err = repo.SaveSubscriptionStatusWithNotification(
+			repository.Subscription{UserID: userID, Link: link, LastStatus: "open"},
+			repository.OutboxItem{
+				UserID:    userID,
+				Link:      link,
+				EventType: 1,
+				Status:    "open",
+				CreatedAt: createdAt,
+			},
+		)
+		if err != nil {
+			t.Fatalf("failed to enqueue notification: %v", err)
+		}
+	}
+}
+
+func testOutbox(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	mustSave(t, repo, repository.Subscription{UserID: 1, Link: link, AppName: "App"})
+
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mustEnqueue(t, repo, createdAt, 1, 2, 3)
+
+	// status is saved along with notification
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "open" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	items, err := repo.GetPendingNotifications(createdAt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+	expected := repository.OutboxItem{
+		ID:            items[0].ID,
+		UserID:        1,
+		Link:          link,
+		EventType:     1,
+		Status:        "open",
+		State:         repository.OutboxPending,
+		CreatedAt:     createdAt,
+		NextAttemptAt: createdAt,
+	}
+	if !reflect.DeepEqual(items[0], expected) {
+		t.Fatalf("unexpected notification: %+v", items[0])
+	}
+
+	err = repo.MarkNotificationDelivered(items[0].ID, createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.MarkNotificationDropped(items[1].ID, "unreachable", createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.RetryNotification(items[2].ID, 0b10, "timeout", createdAt.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// retried notification is pending until its next attempt
+	items, err = repo.GetPendingNotifications(createdAt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+
+	items, err = repo.GetPendingNotifications(createdAt.Add(time.Minute), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].UserID != 3 || items[0].Attempts != 1 ||
+		items[0].NotifierMask != 0b10 || items[0].LastError != "timeout" {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+
+	// nothing is saved for subscription that does not exist
+	err = repo.SaveSubscriptionStatusWithNotification(
+		repository.Subscription{UserID: 4, Link: link, LastStatus: "open"},
+		repository.OutboxItem{UserID: 4, Link: link, EventType: 1, Status: "open", CreatedAt: createdAt},
+	)
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected repository.ErrNotFound, got %v", err)
+	}
+	items, err = repo.GetPendingNotifications(createdAt.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+	mustSave(t, repo, repository.Subscription{UserID: 4, Link: link, AppName: "App"})
+	subs, err = repo.GetUserSubscriptions(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+}
+
+func testRemoveCompletedNotifications(t *testing.T, repo repository.Repository) {
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	mustEnqueue(t, repo, createdAt, 1, 2, 3)
+
+	items, err := repo.GetPendingNotifications(createdAt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+
+	err = repo.MarkNotificationDelivered(items[0].ID, createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.MarkNotificationDropped(items[1].ID, "unreachable", createdAt.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := repo.RemoveCompletedNotifications(createdAt.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed notification, got %d", removed)
+	}
+
+	// pending notification is never removed
+	removed, err = repo.RemoveCompletedNotifications(createdAt.Add(24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed notification, got %d", removed)
+	}
+
+	items, err = repo.GetPendingNotifications(createdAt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].UserID != 3 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+}
+
+func testRemoveUserData(t *testing.T, repo repository.Repository) {
+	const link = "https://testflight.apple.com/join/abc"
+	createdAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, userID := range []int{1, 2} {
+		err := repo.SaveUser(repository.User{ID: userID, LastSeenAt: createdAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustSave(t, repo,
+			repository.Subscription{UserID: userID, Link: link, AppName: "App"},
+			repository.Subscription{UserID: userID, Link: link + "/other", AppName: "Other"},
+		)
+	}
+	mustEnqueue(t, repo, createdAt, 1, 2)
+	err := repo.QuarantineSubscription(repository.Subscription{UserID: 1, Link: link + "/other"}, "broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RemoveUserData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetUser(1)
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("expected repository.ErrUserNotFound, got %v", err)
+	}
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+	items, err := repo.GetPendingNotifications(createdAt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].UserID != 2 {
+		t.Fatalf("unexpected notifications: %+v", items)
+	}
+
+	// status is removed along with subscription
+	mustSave(t, repo, repository.Subscription{UserID: 1, Link: link, AppName: "App"})
+	subs, err = repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// data of other users is kept
+	mustGetUser(t, repo, 2)
+	subs, err = repo.GetUserSubscriptions(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// removal of unknown user is not an error
+	err = repo.RemoveUserData(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,9 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // sqliteRepo is sqlite implementation of Repository
@@ -27,16 +29,331 @@ func NewSqliteRepository(dsn string) (Repository, error) {
 }
 
 func (s *sqliteRepo) SaveSubscription(sub Subscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `INSERT INTO subscriptions (user_id, app_name, link, created_at) VALUES (?, ?, ?, ?)`
+	_, err = tx.Exec(query, sub.UserID, sub.AppName, sub.Link, nullTime(sub.CreatedAt))
+	if err != nil {
+		if isSqliteUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	if sub.LastStatus != "" {
+		_, err = tx.Exec(
+			saveSqliteStatusQuery,
+			sql.Named("user_id", sub.UserID),
+			sql.Named("link", sub.Link),
+			sql.Named("status", sub.LastStatus),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteRepo) RemoveSubscription(sub Subscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `DELETE FROM subscriptions WHERE user_id = ? AND link = ?`
+	res, err := tx.Exec(query, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	const statusQuery = `DELETE FROM subscription_states WHERE user_id = ? AND link = ?`
+	_, err = tx.Exec(statusQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteRepo) UpdateSubscriptionLink(userID int, oldLink, newLink string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `UPDATE subscriptions SET link = ? WHERE user_id = ? AND link = ?`
+	res, err := tx.Exec(query, newLink, userID, oldLink)
+	if err != nil {
+		if isSqliteUniqueViolation(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	// status of the new link can only be left by removed subscription
+	const removeStatusQuery = `DELETE FROM subscription_states WHERE user_id = ? AND link = ?`
+	_, err = tx.Exec(removeStatusQuery, userID, newLink)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`UPDATE subscription_states SET link = ? WHERE user_id = ? AND link = ?`,
+		`UPDATE outbox SET link = ? WHERE user_id = ? AND link = ?`,
+	} {
+		_, err = tx.Exec(query, newLink, userID, oldLink)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// selectSubscriptionsQuery selects subscriptions
+// along with their statuses and beta metadata.
+const selectSubscriptionsQuery = `
+SELECT s.user_id,
+       s.app_name,
+       s.link,
+       COALESCE(st.status, ''),
+       COALESCE(b.icon_url, ''),
+       COALESCE(b.description, ''),
+       COALESCE(b.platforms, ''),
+       COALESCE(b.developer, ''),
+       NOT s.is_active,
+       s.created_at,
+       s.id
+FROM subscriptions s
+         LEFT JOIN subscription_states st ON st.user_id = s.user_id AND st.link = s.link
+         LEFT JOIN betas b ON b.link = s.link
+`
+
+func (s *sqliteRepo) GetSubscription(userID int, id int64) (Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.user_id = ? AND s.id = ?`
+	rows, err := s.db.Query(query, userID, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	subs, err := scanSubscriptions(rows)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(subs) == 0 {
+		return Subscription{}, ErrNotFound
+	}
+
+	return subs[0], nil
+}
+
+func (s *sqliteRepo) GetUserSubscriptions(userID int) ([]Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.user_id = ?`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+func (s *sqliteRepo) GetLinkSubscriptions(link string) ([]Subscription, error) {
+	const query = selectSubscriptionsQuery + `WHERE s.link = ?`
+	rows, err := s.db.Query(query, link)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+func (s *sqliteRepo) GetAllSubscriptions() ([]Subscription, error) {
+	rows, err := s.db.Query(selectSubscriptionsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSubscriptions(rows)
+}
+
+// saveSqliteStatusQuery saves status of subscription if it exists.
+// It is one statement, so subscription can not be removed in between.
+const saveSqliteStatusQuery = `
+INSERT INTO subscription_states (user_id, link, status, updated_at)
+SELECT :user_id, :link, :status, CURRENT_TIMESTAMP
+WHERE EXISTS (SELECT 1 FROM subscriptions WHERE user_id = :user_id AND link = :link)
+ON CONFLICT (user_id, link) DO UPDATE SET status     = excluded.status,
+                                          updated_at = excluded.updated_at;
+`
+
+func (s *sqliteRepo) SaveSubscriptionStatus(sub Subscription) error {
+	res, err := s.db.Exec(
+		saveSqliteStatusQuery,
+		sql.Named("user_id", sub.UserID),
+		sql.Named("link", sub.Link),
+		sql.Named("status", sub.LastStatus),
+	)
+	if err != nil {
+		return err
+	}
+
+	return checkSubscriptionAffected(res)
+}
+
+func (s *sqliteRepo) SaveSubscriptionStatusWithNotification(sub Subscription, item OutboxItem) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	res, err := tx.Exec(
+		saveSqliteStatusQuery,
+		sql.Named("user_id", sub.UserID),
+		sql.Named("link", sub.Link),
+		sql.Named("status", sub.LastStatus),
+	)
+	if err != nil {
+		return err
+	}
+	err = checkSubscriptionAffected(res)
+	if err != nil {
+		return err
+	}
+
+	const query = `
+INSERT INTO outbox (user_id, link, event_type, status, state, created_at, next_attempt_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`
+	createdAt := item.CreatedAt.UTC()
+	_, err = tx.Exec(query, item.UserID, item.Link, item.EventType, item.Status, OutboxPending, createdAt, createdAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteRepo) GetPendingNotifications(now time.Time, limit int) ([]OutboxItem, error) {
+	const query = selectOutboxQuery + `
+WHERE state = ?
+  AND next_attempt_at <= ?
+ORDER BY id
+LIMIT ?
+`
+	rows, err := s.db.Query(query, OutboxPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutbox(rows)
+}
+
+func (s *sqliteRepo) MarkNotificationDelivered(id int64, deliveredAt time.Time) error {
+	const query = `UPDATE outbox SET state = ?, attempts = attempts + 1, completed_at = ? WHERE id = ?`
+	_, err := s.db.Exec(query, OutboxDelivered, deliveredAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteRepo) MarkNotificationDropped(id int64, reason string, droppedAt time.Time) error {
+	const query = `UPDATE outbox SET state = ?, last_error = ?, completed_at = ? WHERE id = ?`
+	_, err := s.db.Exec(query, OutboxDropped, reason, droppedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteRepo) RetryNotification(id int64, notifierMask int64, lastError string, nextAttemptAt time.Time) error {
+	const query = `
+UPDATE outbox
+SET attempts        = attempts + 1,
+    notifier_mask   = ?,
+    last_error      = ?,
+    next_attempt_at = ?
+WHERE id = ?
+`
+	_, err := s.db.Exec(query, notifierMask, lastError, nextAttemptAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteRepo) RemoveCompletedNotifications(before time.Time) (int64, error) {
+	const query = `DELETE FROM outbox WHERE state <> ? AND completed_at < ?`
+	res, err := s.db.Exec(query, OutboxPending, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *sqliteRepo) UpdateAppName(link, appName string) error {
+	const query = `UPDATE subscriptions SET app_name = ? WHERE link = ?`
+	_, err := s.db.Exec(query, appName, link)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteRepo) SaveBetaMetadata(link string, md BetaMetadata) error {
 	const query = `
-INSERT INTO subscriptions (user_id, app_name, link)
-SELECT :user_id, :app_name, :link
-WHERE NOT EXISTS(SELECT 1 FROM subscriptions WHERE user_id = :user_id AND link = :link);
+INSERT INTO betas (link, icon_url, description, platforms, developer, updated_at)
+VALUES (:link, :icon_url, :description, :platforms, :developer, CURRENT_TIMESTAMP)
+ON CONFLICT (link) DO UPDATE SET icon_url    = excluded.icon_url,
+                                 description = excluded.description,
+                                 platforms   = excluded.platforms,
+                                 developer   = excluded.developer,
+                                 updated_at  = excluded.updated_at;
 `
 	_, err := s.db.Exec(
 		query,
-		sql.Named("user_id", sub.UserID),
-		sql.Named("app_name", sub.AppName),
-		sql.Named("link", sub.Link),
+		sql.Named("link", link),
+		sql.Named("icon_url", md.IconURL),
+		sql.Named("description", md.Description),
+		sql.Named("platforms", joinPlatforms(md.Platforms)),
+		sql.Named("developer", md.Developer),
 	)
 	if err != nil {
 		return err
@@ -45,9 +362,63 @@ WHERE NOT EXISTS(SELECT 1 FROM subscriptions WHERE user_id = :user_id AND link =
 	return nil
 }
 
-func (s *sqliteRepo) RemoveSubscription(sub Subscription) error {
-	const query = `DELETE FROM subscriptions WHERE user_id = ? AND link = ?`
-	_, err := s.db.Exec(query, sub.UserID, sub.Link)
+func (s *sqliteRepo) SetUserSubscriptionsActive(userID int, isActive bool) (int64, error) {
+	const query = `UPDATE subscriptions SET is_active = ? WHERE user_id = ? AND is_active <> ?`
+	res, err := s.db.Exec(query, isActive, userID, isActive)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *sqliteRepo) QuarantineSubscription(sub Subscription, reason string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	const query = `
+INSERT INTO quarantined_subscriptions (user_id, app_name, link, reason, quarantined_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+`
+	_, err = tx.Exec(query, sub.UserID, sub.AppName, sub.Link, reason)
+	if err != nil {
+		return err
+	}
+
+	const deleteQuery = `DELETE FROM subscriptions WHERE user_id = ? AND link = ?`
+	_, err = tx.Exec(deleteQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	const statusQuery = `DELETE FROM subscription_states WHERE user_id = ? AND link = ?`
+	_, err = tx.Exec(statusQuery, sub.UserID, sub.Link)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteRepo) SaveBetaCheck(check BetaCheck) error {
+	const query = `
+INSERT INTO beta_checks (link, checked_at, status, status_code, latency_ms, error)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+	_, err := s.db.Exec(
+		query,
+		check.Link,
+		check.CheckedAt.UTC(),
+		check.Status,
+		check.StatusCode,
+		check.Latency.Milliseconds(),
+		check.Error,
+	)
 	if err != nil {
 		return err
 	}
@@ -55,62 +426,383 @@ func (s *sqliteRepo) RemoveSubscription(sub Subscription) error {
 	return nil
 }
 
-func (s *sqliteRepo) GetUserSubscriptions(userID int) ([]Subscription, error) {
-	const query = `SELECT user_id, app_name, link FROM subscriptions WHERE user_id = ?`
+func (s *sqliteRepo) GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error) {
+	const query = `
+SELECT link, checked_at, status, status_code, latency_ms, error
+FROM beta_checks
+WHERE link = ?
+  AND checked_at >= ?
+  AND checked_at < ?
+ORDER BY checked_at, id
+`
+	rows, err := s.db.Query(query, link, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanBetaChecks(rows)
+}
+
+func (s *sqliteRepo) GetLastBetaCheck(link string) (BetaCheck, error) {
+	const query = `
+SELECT link, checked_at, status, status_code, latency_ms, error
+FROM beta_checks
+WHERE link = ?
+ORDER BY checked_at DESC, id DESC
+LIMIT 1
+`
+	rows, err := s.db.Query(query, link)
+	if err != nil {
+		return BetaCheck{}, err
+	}
+
+	checks, err := scanBetaChecks(rows)
+	if err != nil {
+		return BetaCheck{}, err
+	}
+	if len(checks) == 0 {
+		return BetaCheck{}, ErrBetaCheckNotFound
+	}
+
+	return checks[0], nil
+}
+
+func (s *sqliteRepo) RemoveBetaChecks(before time.Time) (int64, error) {
+	const query = `DELETE FROM beta_checks WHERE checked_at < ?`
+	res, err := s.db.Exec(query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *sqliteRepo) DownsampleBetaChecks(before time.Time, interval time.Duration) (int64, error) {
+	seconds, err := intervalSeconds(interval)
+	if err != nil {
+		return 0, err
+	}
+
+	const query = `
+DELETE
+FROM beta_checks
+WHERE checked_at < :before
+  AND id NOT IN (SELECT MIN(id)
+                 FROM beta_checks
+                 WHERE checked_at < :before
+                 GROUP BY link, status, CAST(strftime('%s', checked_at) AS integer) / :seconds)
+`
+	res, err := s.db.Exec(
+		query,
+		sql.Named("before", before.UTC()),
+		sql.Named("seconds", seconds),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *sqliteRepo) SaveUser(user User) error {
+	const query = `
+INSERT INTO users (id, username, language_code, is_blocked, created_at, last_seen_at)
+VALUES (?, ?, ?, false, ?, ?)
+ON CONFLICT (id) DO UPDATE SET username      = excluded.username,
+                               language_code = excluded.language_code,
+                               last_seen_at  = excluded.last_seen_at;
+`
+	lastSeenAt := user.LastSeenAt.UTC()
+	_, err := s.db.Exec(query, user.ID, user.Username, user.LanguageCode, lastSeenAt, lastSeenAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteRepo) GetUser(userID int) (User, error) {
+	const query = selectUsersQuery + `WHERE id = ?`
 	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return User{}, err
+	}
+
+	users, err := scanUsers(rows)
+	if err != nil {
+		return User{}, err
+	}
+	if len(users) == 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	return users[0], nil
+}
+
+func (s *sqliteRepo) GetUsersSeenBefore(t time.Time) ([]User, error) {
+	const query = selectUsersQuery + `WHERE last_seen_at < ? ORDER BY last_seen_at`
+	rows, err := s.db.Query(query, t.UTC())
 	if err != nil {
 		return nil, err
 	}
+
+	return scanUsers(rows)
+}
+
+func (s *sqliteRepo) SetUserBlocked(userID int, isBlocked bool) error {
+	const query = `UPDATE users SET is_blocked = ? WHERE id = ?`
+	res, err := s.db.Exec(query, isBlocked, userID)
+	if err != nil {
+		return err
+	}
+
+	return checkUserAffected(res)
+}
+
+func (s *sqliteRepo) SaveUserPreferences(userID int, timezone string, preferences []byte) error {
+	const query = `UPDATE users SET timezone = ?, preferences = ? WHERE id = ?`
+	res, err := s.db.Exec(query, timezone, string(preferences), userID)
+	if err != nil {
+		return err
+	}
+
+	return checkUserAffected(res)
+}
+
+func (s *sqliteRepo) RemoveUserData(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	for _, query := range []string{
+		`DELETE FROM subscriptions WHERE user_id = ?`,
+		`DELETE FROM subscription_states WHERE user_id = ?`,
+		`DELETE FROM quarantined_subscriptions WHERE user_id = ?`,
+		`DELETE FROM outbox WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	} {
+		_, err = tx.Exec(query, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteRepo) Close() error {
+	return s.db.Close()
+}
+
+func isSqliteUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// scanSubscriptions scans rows selected by selectSubscriptionsQuery and closes them.
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
 	defer func(rows *sql.Rows) {
 		_ = rows.Close()
 	}(rows)
 
 	var res []Subscription
 	for rows.Next() {
-		var sub Subscription
-		err = rows.Scan(&sub.UserID, &sub.AppName, &sub.Link)
+		var (
+			sub       Subscription
+			platforms string
+			createdAt sql.NullTime
+		)
+		err := rows.Scan(
+			&sub.UserID,
+			&sub.AppName,
+			&sub.Link,
+			&sub.LastStatus,
+			&sub.Metadata.IconURL,
+			&sub.Metadata.Description,
+			&platforms,
+			&sub.Metadata.Developer,
+			&sub.Inactive,
+			&createdAt,
+			&sub.ID,
+		)
 		if err != nil {
 			return nil, err
 		}
+		sub.Metadata.Platforms = splitPlatforms(platforms)
+		if createdAt.Valid {
+			sub.CreatedAt = createdAt.Time.UTC()
+		}
 		res = append(res, sub)
 	}
 
-	return res, nil
+	return res, rows.Err()
 }
 
-func (s *sqliteRepo) GetAllSubscriptions() ([]Subscription, error) {
-	const query = `SELECT user_id, app_name, link FROM subscriptions`
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, err
+// nullTime returns NULL for zero time.
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
 	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// scanBetaChecks scans rows of beta_checks and closes them.
+func scanBetaChecks(rows *sql.Rows) ([]BetaCheck, error) {
 	defer func(rows *sql.Rows) {
 		_ = rows.Close()
 	}(rows)
 
-	var res []Subscription
+	var res []BetaCheck
 	for rows.Next() {
-		var sub Subscription
-		err = rows.Scan(&sub.UserID, &sub.AppName, &sub.Link)
+		var (
+			check     BetaCheck
+			latencyMS int64
+		)
+		err := rows.Scan(
+			&check.Link,
+			&check.CheckedAt,
+			&check.Status,
+			&check.StatusCode,
+			&latencyMS,
+			&check.Error,
+		)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, sub)
+		check.CheckedAt = check.CheckedAt.UTC()
+		check.Latency = time.Duration(latencyMS) * time.Millisecond
+		res = append(res, check)
 	}
 
-	return res, nil
+	return res, rows.Err()
 }
 
-func (s *sqliteRepo) DeleteAllSubscriptions() error {
-	const query = `DELETE FROM subscriptions`
-	_, err := s.db.Exec(query)
+// selectOutboxQuery selects outbox items.
+const selectOutboxQuery = `
+SELECT id,
+       user_id,
+       link,
+       event_type,
+       status,
+       state,
+       attempts,
+       notifier_mask,
+       last_error,
+       created_at,
+       next_attempt_at,
+       completed_at
+FROM outbox
+`
+
+// scanOutbox scans rows selected by selectOutboxQuery and closes them.
+func scanOutbox(rows *sql.Rows) ([]OutboxItem, error) {
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var res []OutboxItem
+	for rows.Next() {
+		var (
+			item        OutboxItem
+			completedAt sql.NullTime
+		)
+		err := rows.Scan(
+			&item.ID,
+			&item.UserID,
+			&item.Link,
+			&item.EventType,
+			&item.Status,
+			&item.State,
+			&item.Attempts,
+			&item.NotifierMask,
+			&item.LastError,
+			&item.CreatedAt,
+			&item.NextAttemptAt,
+			&completedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.CreatedAt = item.CreatedAt.UTC()
+		item.NextAttemptAt = item.NextAttemptAt.UTC()
+		if completedAt.Valid {
+			item.CompletedAt = completedAt.Time.UTC()
+		}
+		res = append(res, item)
+	}
+
+	return res, rows.Err()
+}
+
+// selectUsersQuery selects users.
+const selectUsersQuery = `
+SELECT id, username, language_code, timezone, preferences, is_blocked, created_at, last_seen_at
+FROM users
+`
+
+// scanUsers scans rows selected by selectUsersQuery and closes them.
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var res []User
+	for rows.Next() {
+		var (
+			user        User
+			preferences string
+		)
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.LanguageCode,
+			&user.Timezone,
+			&preferences,
+			&user.IsBlocked,
+			&user.CreatedAt,
+			&user.LastSeenAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if preferences != "" {
+			user.Preferences = []byte(preferences)
+		}
+		user.CreatedAt = user.CreatedAt.UTC()
+		user.LastSeenAt = user.LastSeenAt.UTC()
+		res = append(res, user)
+	}
+
+	return res, rows.Err()
+}
+
+// checkSubscriptionAffected returns ErrNotFound if no subscription is affected.
+func checkSubscriptionAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return ErrNotFound
+	}
 
 	return nil
 }
 
-func (s *sqliteRepo) Close() error {
-	return s.db.Close()
+// checkUserAffected returns ErrUserNotFound if no user is affected.
+func checkUserAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
 }
@@ -1,8 +1,9 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"strconv"
+	"sync"
 	"time"
 
 	"git.sr.ht/~mcldresner/tfdog/beta"
@@ -18,27 +19,95 @@ var (
 
 	// ErrAlreadySubscribed may be returned if link is already subscribed.
 	ErrAlreadySubscribed = errors.New("link already subscribed")
+
+	// ErrUserNotFound may be returned if user is not found.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrBetaCheckNotFound may be returned if beta has not been checked yet.
+	ErrBetaCheckNotFound = errors.New("beta check not found")
+
+	// ErrUnknownStatus is reason of EventCheckFailed
+	// if status of beta can not be determined.
+	ErrUnknownStatus = errors.New("status of beta is unknown")
 )
 
+// Tags of service jobs.
+// They can not clash with tags of checks that are beta links.
+const (
+	reconcileTag = "reconcile"
+	historyTag   = "history"
+)
+
+// historyMaintenanceInterval is interval between
+// retention and downsampling of check history.
+const historyMaintenanceInterval = time.Hour
+
 type srv struct {
 	sc        *gocron.Scheduler // scheduler will be started after first subscription
 	isStarted *atomic.Bool
+	cfg       Config
+
+	ctx    context.Context // ctx is canceled when service is closed
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // wg waits for background goroutines
+
+	dispatchCh chan struct{} // dispatchCh wakes dispatcher of outbox
+
+	changeMu sync.Mutex // changeMu serializes changes of subscriptions
+
+	mu        sync.Mutex
+	jobs      map[string]*linkJob // jobs by beta link
+	notifiers []Notifier
 
 	repo   repository.Repository
 	logger *zap.Logger
 }
 
 // NewService new Service instance.
-func NewService(repo repository.Repository, interval time.Duration) Service {
-	return &srv{
-		sc:        gocron.NewScheduler(time.UTC).Every(interval),
-		isStarted: atomic.NewBool(false),
-		repo:      repo,
-		logger:    zap.L().Named("service"),
+func NewService(repo repository.Repository, cfg Config) Service {
+	if cfg.DispatchWorkers <= 0 {
+		cfg.DispatchWorkers = 1
+	}
+	if cfg.DispatchAttempts <= 0 {
+		cfg.DispatchAttempts = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &srv{
+		sc:         gocron.NewScheduler(time.UTC),
+		isStarted:  atomic.NewBool(false),
+		cfg:        cfg,
+		ctx:        ctx,
+		cancel:     cancel,
+		dispatchCh: make(chan struct{}, 1),
+		jobs:       make(map[string]*linkJob),
+		repo:       repo,
+		logger:     zap.L().Named("service"),
+	}
+
+	if cfg.DispatchInterval > 0 {
+		s.wg.Add(1)
+		go s.runDispatcher()
+	}
+
+	if cfg.ReconcileInterval > 0 {
+		_, err := s.sc.Every(cfg.ReconcileInterval).Tag(reconcileTag).Do(s.reconcile)
+		if err != nil {
+			s.logger.With(zap.Error(err)).Error("failed to schedule reconciliation")
+		}
 	}
+
+	if cfg.HistoryRetention > 0 || cfg.HistoryDownsampleAfter > 0 {
+		_, err := s.sc.Every(historyMaintenanceInterval).Tag(historyTag).Do(s.maintainHistory)
+		if err != nil {
+			s.logger.With(zap.Error(err)).Error("failed to schedule history maintenance")
+		}
+	}
+
+	return s
 }
 
-func (s *srv) Subscribe(userID int, link string, payload func(*beta.Beta)) error {
+func (s *srv) Subscribe(ctx context.Context, userID int, link string) error {
 	logger := s.logger.
 		With(zap.String("method", "subscribe")).
 		With(zap.Int("user_id", userID)).
@@ -47,6 +116,33 @@ func (s *srv) Subscribe(userID int, link string, payload func(*beta.Beta)) error
 	logger.Debug("got request")
 	defer logger.Debug("done")
 
+	return s.subscribe(ctx, logger, repository.Subscription{UserID: userID, Link: link})
+}
+
+func (s *srv) Resubscribe(ctx context.Context, sub Subscription) error {
+	logger := s.logger.
+		With(zap.String("method", "resubscribe")).
+		With(zap.Int("user_id", sub.UserID)).
+		With(zap.String("link", sub.Link))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	return s.subscribe(ctx, logger, sub.Subscription)
+}
+
+// subscribe saves subscription of the user to the link and schedules checks of the beta.
+// Last status and creation time of sub are saved too, creation time defaults to now.
+func (s *srv) subscribe(ctx context.Context, logger *zap.Logger, sub repository.Subscription) error {
+	userID := sub.UserID
+	link, err := beta.ParseLink(sub.Link)
+	if err != nil {
+		logger.With(zap.Error(err)).Debug("invalid link")
+		return err
+	}
+
+	// it is just a shortcut to not request TestFlight in vain,
+	// duplicates are prevented by repository.
 	isSubscribed, err := s.isSubscribed(userID, link)
 	if err != nil {
 		logger.With(zap.Error(err)).Error("failed to check whether link is subscribed")
@@ -56,37 +152,44 @@ func (s *srv) Subscribe(userID int, link string, payload func(*beta.Beta)) error
 		return ErrAlreadySubscribed
 	}
 
-	b, err := beta.NewTFBeta(link)
+	b, err := s.getBeta(ctx, link)
 	if err != nil {
 		logger.With(zap.Error(err)).Error("failed to create beta")
 		return err
 	}
 
-	job, err := s.sc.Do(payload, b)
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	sub.Link = link
+	sub.AppName = b.GetAppName()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+	err = s.repo.SaveSubscription(sub)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return ErrAlreadySubscribed
+	}
 	if err != nil {
-		logger.With(zap.Error(err)).Error("failed to schedule payload")
+		logger.With(zap.Error(err)).Error("failed to save subscription")
+		return err
 	}
-	job.Tag(strconv.Itoa(userID) + link)
 
-	err = s.repo.SaveSubscription(
-		repository.Subscription{
-			UserID:  userID,
-			Link:    link,
-			AppName: b.GetAppName(),
-		},
-	)
+	err = s.attach(userID, b)
 	if err != nil {
-		logger.With(zap.Error(err)).Error("failed to save subscription")
-		s.sc.RemoveByReference(job)
+		logger.With(zap.Error(err)).Error("failed to schedule check")
+		if err := s.repo.RemoveSubscription(sub); err != nil {
+			logger.With(zap.Error(err)).Error("failed to remove subscription")
+		}
 		return err
 	}
 
-	if !s.isStarted.Load() {
-		s.sc.StartAsync()
-		s.isStarted.Store(true)
-		logger.Debug("scheduler is started")
+	err = s.repo.SaveBetaMetadata(link, castMetadata(b.GetMetadata()))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to save beta metadata")
 	}
 
+	s.start()
 	return nil
 }
 
@@ -99,23 +202,34 @@ func (s *srv) Unsubscribe(userID int, link string) error {
 	logger.Debug("got request")
 	defer logger.Debug("done")
 
-	err := s.sc.RemoveByTag(strconv.Itoa(userID) + link)
+	link, err := beta.ParseLink(link)
 	if err != nil {
-		logger.With(zap.Error(err)).Error("job not found")
+		logger.With(zap.Error(err)).Debug("invalid link")
 		return ErrSubscriptionNotFound
 	}
 
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	// subscription is removed from repository first,
+	// so a failure leaves the service unchanged.
 	err = s.repo.RemoveSubscription(repository.Subscription{
 		UserID: userID,
 		Link:   link,
 	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSubscriptionNotFound
+	}
 	if err != nil {
-		s.logger.
-			With(zap.Error(err)).
-			Error("failed to remove subscription")
+		logger.With(zap.Error(err)).Error("failed to remove subscription")
 		return err
 	}
 
+	ok := s.detach(userID, link)
+	if !ok {
+		logger.Warn("job not found")
+	}
+
 	return nil
 }
 
@@ -136,13 +250,750 @@ func (s *srv) GetUserSubscriptions(userID int) ([]Subscription, error) {
 	return castSubscriptions(subs), nil
 }
 
+func (s *srv) GetSubscription(userID int, id int64) (Subscription, error) {
+	logger := s.logger.
+		With(zap.String("method", "get_subscription")).
+		With(zap.Int("user_id", userID)).
+		With(zap.Int64("id", id))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	sub, err := s.repo.GetSubscription(userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get subscription")
+		return Subscription{}, err
+	}
+
+	return Subscription{Subscription: sub}, nil
+}
+
+func (s *srv) GetLastBetaCheck(link string) (BetaCheck, error) {
+	logger := s.logger.
+		With(zap.String("method", "get_last_beta_check")).
+		With(zap.String("link", link))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	check, err := s.repo.GetLastBetaCheck(link)
+	if errors.Is(err, repository.ErrBetaCheckNotFound) {
+		return BetaCheck{}, ErrBetaCheckNotFound
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get last beta check")
+		return BetaCheck{}, err
+	}
+
+	return BetaCheck{BetaCheck: check}, nil
+}
+
+func (s *srv) GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error) {
+	logger := s.logger.
+		With(zap.String("method", "get_beta_checks")).
+		With(zap.String("link", link))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	checks, err := s.repo.GetBetaChecks(link, from, to)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get beta checks")
+		return nil, err
+	}
+
+	res := make([]BetaCheck, len(checks))
+	for i, check := range checks {
+		res[i] = BetaCheck{BetaCheck: check}
+	}
+
+	return res, nil
+}
+
+func (s *srv) Restore(sub Subscription) error {
+	logger := s.logger.
+		With(zap.String("method", "restore")).
+		With(zap.Int("user_id", sub.UserID)).
+		With(zap.String("link", sub.Link))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	err := s.restore(sub.Subscription)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to restore subscription")
+		return err
+	}
+
+	s.start()
+	return nil
+}
+
+func (s *srv) ReactivateUser(userID int) (int, error) {
+	logger := s.logger.
+		With(zap.String("method", "reactivate_user")).
+		With(zap.Int("user_id", userID))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	err := s.repo.SetUserBlocked(userID, false)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		logger.With(zap.Error(err)).Error("failed to mark user as not blocked")
+		return 0, err
+	}
+
+	subs, err := s.repo.GetUserSubscriptions(userID)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get user subscriptions")
+		return 0, err
+	}
+
+	var inactive []repository.Subscription
+	for _, sub := range subs {
+		if sub.Inactive {
+			inactive = append(inactive, sub)
+		}
+	}
+	if len(inactive) == 0 {
+		return 0, nil
+	}
+
+	_, err = s.repo.SetUserSubscriptionsActive(userID, true)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to activate subscriptions")
+		return 0, err
+	}
+
+	for _, sub := range inactive {
+		err = s.restore(sub)
+		if err != nil {
+			// it will be restored by the next reconciliation
+			logger.
+				With(zap.Error(err)).
+				With(zap.String("link", sub.Link)).
+				Error("failed to restore subscription")
+		}
+	}
+
+	s.start()
+	logger.With(zap.Int("reactivated", len(inactive))).Info("subscriptions are reactivated")
+	return len(inactive), nil
+}
+
+func (s *srv) SaveUser(user User) error {
+	logger := s.logger.
+		With(zap.String("method", "save_user")).
+		With(zap.Int("user_id", user.ID))
+
+	user.LastSeenAt = time.Now()
+	err := s.repo.SaveUser(user.User)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to save user")
+		return err
+	}
+
+	return nil
+}
+
+func (s *srv) GetUser(userID int) (User, error) {
+	logger := s.logger.
+		With(zap.String("method", "get_user")).
+		With(zap.Int("user_id", userID))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	user, err := s.repo.GetUser(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get user")
+		return User{}, err
+	}
+
+	return User{User: user}, nil
+}
+
+func (s *srv) DeleteUser(userID int) error {
+	logger := s.logger.
+		With(zap.String("method", "delete_user")).
+		With(zap.Int("user_id", userID))
+
+	logger.Debug("got request")
+	defer logger.Debug("done")
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	subs, err := s.repo.GetUserSubscriptions(userID)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get user subscriptions")
+		return err
+	}
+
+	// data is removed from repository first,
+	// so a failure leaves the service unchanged.
+	err = s.repo.RemoveUserData(userID)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to remove user data")
+		return err
+	}
+
+	for _, sub := range subs {
+		s.detach(userID, sub.Link)
+	}
+
+	logger.With(zap.Int("subscriptions", len(subs))).Info("user is deleted")
+	return nil
+}
+
+func (s *srv) RegisterNotifier(n Notifier) {
+	s.mu.Lock()
+	s.notifiers = append(s.notifiers, n)
+	s.mu.Unlock()
+
+	// notifications could wait for the notifier in outbox
+	s.wakeDispatcher()
+}
+
 func (s *srv) Close() error {
+	s.cancel()
 	if s.isStarted.Load() {
 		s.sc.Stop()
 	}
+	s.wg.Wait()
 	return nil
 }
 
+// start starts scheduler if it is not started yet.
+func (s *srv) start() {
+	if s.isStarted.CAS(false, true) {
+		s.sc.StartAsync()
+		s.logger.Debug("scheduler is started")
+	}
+}
+
+// restore attaches stored subscription without requesting TestFlight.
+func (s *srv) restore(sub repository.Subscription) error {
+	b, err := beta.RestoreTFBeta(sub.Link, sub.AppName, castBetaMetadata(sub.Metadata))
+	if err != nil {
+		return err
+	}
+	if b.GetLink() != sub.Link {
+		// jobs are keyed by canonical links, so subscription
+		// with another link would never be found by the job.
+		return beta.ErrInvalidTestFlightLink
+	}
+
+	return s.attach(sub.UserID, b.WithClient(s.cfg.HTTPClient).WithRequestTimeout(s.cfg.RequestTimeout))
+}
+
+// reconcile repairs drift between scheduled checks and stored subscriptions.
+// Stored active subscriptions without checks are restored,
+// subscribers that have no stored active subscription are detached.
+func (s *srv) reconcile() {
+	logger := s.logger.With(zap.String("method", "reconcile"))
+
+	logger.Debug("reconciliation is started")
+	defer logger.Debug("done")
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	subs, err := s.repo.GetAllSubscriptions()
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get all subscriptions")
+		return
+	}
+	subs = activeSubscriptions(subs)
+
+	stored := make(map[string]map[int]struct{})
+	for _, sub := range subs {
+		if stored[sub.Link] == nil {
+			stored[sub.Link] = make(map[int]struct{})
+		}
+		stored[sub.Link][sub.UserID] = struct{}{}
+	}
+
+	s.mu.Lock()
+	var missing []repository.Subscription
+	for _, sub := range subs {
+		job, ok := s.jobs[sub.Link]
+		if ok {
+			_, ok = job.subscribers[sub.UserID]
+		}
+		if !ok {
+			missing = append(missing, sub)
+		}
+	}
+	orphaned := make(map[string][]int)
+	for link, job := range s.jobs {
+		for userID := range job.subscribers {
+			if _, ok := stored[link][userID]; !ok {
+				orphaned[link] = append(orphaned[link], userID)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sub := range missing {
+		err := s.restore(sub)
+		if err != nil {
+			logger.
+				With(zap.Error(err)).
+				With(zap.Int("user_id", sub.UserID)).
+				With(zap.String("link", sub.Link)).
+				Error("failed to restore subscription")
+			continue
+		}
+
+		logger.
+			With(zap.Int("user_id", sub.UserID)).
+			With(zap.String("link", sub.Link)).
+			Warn("missing check is restored")
+	}
+
+	for link, userIDs := range orphaned {
+		for _, userID := range userIDs {
+			s.detach(userID, link)
+			logger.
+				With(zap.Int("user_id", userID)).
+				With(zap.String("link", link)).
+				Warn("orphaned check is removed")
+		}
+	}
+}
+
+// getBeta returns beta of already scheduled job
+// or creates new one if link is not scheduled yet.
+func (s *srv) getBeta(ctx context.Context, link string) (*beta.Beta, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[link]
+	s.mu.Unlock()
+	if ok {
+		return job.beta, nil
+	}
+
+	// request is canceled when service is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return beta.NewTFBetaWithOptions(ctx, link, beta.Options{
+		Client:         s.cfg.HTTPClient,
+		RequestTimeout: s.cfg.RequestTimeout,
+	})
+}
+
+// attach adds user to subscribers of the beta.
+// Check of the beta is scheduled if user is the first subscriber.
+func (s *srv) attach(userID int, b *beta.Beta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link := b.GetLink()
+	job, ok := s.jobs[link]
+	if !ok {
+		job = newLinkJob(b)
+
+		var err error
+		job.job, err = s.sc.Every(s.cfg.Interval).Tag(link).Do(s.check, link)
+		if err != nil {
+			return err
+		}
+
+		s.jobs[link] = job
+		s.logger.
+			With(zap.String("link", link)).
+			Debug("check is scheduled")
+	}
+
+	job.subscribers[userID] = struct{}{}
+	return nil
+}
+
+// detach removes user from subscribers of the beta.
+// Check of the beta is removed if user is the last subscriber.
+// It returns false if user is not subscribed to the beta.
+func (s *srv) detach(userID int, link string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[link]
+	if !ok {
+		return false
+	}
+	if _, ok = job.subscribers[userID]; !ok {
+		return false
+	}
+
+	delete(job.subscribers, userID)
+	if job.subscribersCount() == 0 {
+		s.sc.RemoveByReference(job.job)
+		delete(s.jobs, link)
+		s.logger.
+			With(zap.String("link", link)).
+			Debug("check is removed")
+	}
+
+	return true
+}
+
+// check checks the beta once and notifies all subscribers
+// whose last known status differs from the current one.
+func (s *srv) check(link string) {
+	logger := s.logger.
+		With(zap.String("method", "check")).
+		With(zap.String("link", link))
+
+	logger.Debug("check is started")
+	defer logger.Debug("done")
+
+	s.mu.Lock()
+	job, ok := s.jobs[link]
+	if !ok {
+		s.mu.Unlock()
+		logger.Debug("job is removed")
+		return
+	}
+	b, subscribers := job.beta, job.copySubscribers()
+	s.mu.Unlock()
+
+	ctx := s.ctx
+	if s.cfg.CheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.CheckTimeout)
+		defer cancel()
+	}
+
+	checkedAt := time.Now()
+	res, err := b.CheckContext(ctx)
+	latency := time.Since(checkedAt)
+	logger = logger.
+		With(zap.Stringer("status", res.Status)).
+		With(zap.Int("status_code", res.StatusCode)).
+		With(zap.String("evidence", res.Evidence))
+	if err != nil {
+		if s.ctx.Err() != nil {
+			logger.Debug("check is canceled")
+			return
+		}
+		logger.With(zap.Error(err)).Error("failed to check beta")
+		s.saveCheck(link, checkedAt, latency, res, err)
+		s.emitCheckFailed(b, err)
+		return
+	}
+	if res.Status == beta.StatusUnknown {
+		logger.Warn("status of beta is unknown")
+		s.saveCheck(link, checkedAt, latency, res, ErrUnknownStatus)
+		s.emitCheckFailed(b, ErrUnknownStatus)
+		return
+	}
+	s.saveCheck(link, checkedAt, latency, res, nil)
+
+	subs, err := s.repo.GetLinkSubscriptions(link)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get link subscriptions")
+		return
+	}
+
+	logger.
+		With(zap.Int("subscribers", len(subs))).
+		Debug("beta is checked")
+
+	s.updateAppName(link, res.AppName, subs)
+	s.updateMetadata(link, res.Metadata, subs)
+
+	for _, sub := range subs {
+		if _, ok := subscribers[sub.UserID]; !ok {
+			continue
+		}
+
+		if res.AppName != "" {
+			sub.AppName = res.AppName
+			sub.Metadata = castMetadata(res.Metadata)
+		}
+		s.notify(sub, res.Status)
+	}
+}
+
+// saveCheck saves result of the check to history.
+func (s *srv) saveCheck(link string, checkedAt time.Time, latency time.Duration, res beta.CheckResult, checkErr error) {
+	check := repository.BetaCheck{
+		Link:       link,
+		CheckedAt:  checkedAt,
+		Status:     res.Status.String(),
+		StatusCode: res.StatusCode,
+		Latency:    latency,
+	}
+	if checkErr != nil {
+		check.Error = checkErr.Error()
+	}
+
+	err := s.repo.SaveBetaCheck(check)
+	if err != nil {
+		s.logger.
+			With(zap.Error(err)).
+			With(zap.String("link", link)).
+			Error("failed to save beta check")
+	}
+}
+
+// maintainHistory removes checks older than retention
+// and downsamples checks older than HistoryDownsampleAfter.
+func (s *srv) maintainHistory() {
+	logger := s.logger.With(zap.String("method", "maintain_history"))
+
+	logger.Debug("history maintenance is started")
+	defer logger.Debug("done")
+
+	now := time.Now()
+	if s.cfg.HistoryRetention > 0 {
+		removed, err := s.repo.RemoveBetaChecks(now.Add(-s.cfg.HistoryRetention))
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to remove old beta checks")
+		} else {
+			logger.With(zap.Int64("removed", removed)).Debug("old beta checks are removed")
+		}
+	}
+
+	if s.cfg.HistoryRetention > 0 {
+		removed, err := s.repo.RemoveCompletedNotifications(now.Add(-s.cfg.HistoryRetention))
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to remove completed notifications")
+		} else {
+			logger.With(zap.Int64("removed", removed)).Debug("completed notifications are removed")
+		}
+	}
+
+	if s.cfg.HistoryDownsampleAfter > 0 {
+		removed, err := s.repo.DownsampleBetaChecks(
+			now.Add(-s.cfg.HistoryDownsampleAfter),
+			s.cfg.HistoryDownsampleInterval,
+		)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to downsample beta checks")
+		} else {
+			logger.With(zap.Int64("removed", removed)).Debug("beta checks are downsampled")
+		}
+	}
+}
+
+// updateAppName renames app of subscriptions
+// if name found on TestFlight page differs from the stored one.
+// It allows to resolve placeholder names.
+func (s *srv) updateAppName(link, appName string, subs []repository.Subscription) {
+	if appName == "" {
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.AppName == appName {
+			continue
+		}
+
+		err := s.repo.UpdateAppName(link, appName)
+		if err != nil {
+			s.logger.
+				With(zap.Error(err)).
+				With(zap.String("link", link)).
+				Error("failed to update app name")
+			return
+		}
+
+		s.logger.
+			With(zap.String("link", link)).
+			With(zap.String("prev_app_name", sub.AppName)).
+			With(zap.String("app_name", appName)).
+			Info("app name is updated")
+		return
+	}
+}
+
+// updateMetadata saves metadata found on TestFlight page
+// if it differs from the stored one.
+func (s *srv) updateMetadata(link string, md beta.Metadata, subs []repository.Subscription) {
+	if md.IsZero() || len(subs) == 0 {
+		return
+	}
+
+	repoMD := castMetadata(md)
+	if isMetadataEqual(repoMD, subs[0].Metadata) {
+		return
+	}
+
+	err := s.repo.SaveBetaMetadata(link, repoMD)
+	if err != nil {
+		s.logger.
+			With(zap.Error(err)).
+			With(zap.String("link", link)).
+			Error("failed to save beta metadata")
+		return
+	}
+
+	s.logger.
+		With(zap.String("link", link)).
+		Debug("beta metadata is updated")
+}
+
+// notify saves new status of subscription.
+// If status is changed since the last check and users are interested in it,
+// notification is added to outbox along with the status.
+// Nothing is saved if subscription is removed since the check is started.
+func (s *srv) notify(sub repository.Subscription, status beta.Status) {
+	logger := s.logger.
+		With(zap.String("method", "notify")).
+		With(zap.Int("user_id", sub.UserID)).
+		With(zap.String("link", sub.Link))
+
+	prevStatus := sub.LastStatus
+	if prevStatus == status.String() {
+		return
+	}
+
+	var eventType EventType
+	switch {
+	case status == beta.StatusOpen:
+		eventType = EventBetaOpened
+	case prevStatus == beta.StatusOpen.String() && s.cfg.NotifyClosed:
+		eventType = EventBetaClosed
+	}
+
+	sub.LastStatus = status.String()
+	var err error
+	if eventType == 0 {
+		err = s.repo.SaveSubscriptionStatus(sub)
+	} else {
+		err = s.repo.SaveSubscriptionStatusWithNotification(sub, repository.OutboxItem{
+			UserID:    sub.UserID,
+			Link:      sub.Link,
+			EventType: int(eventType),
+			Status:    status.String(),
+			CreatedAt: time.Now(),
+		})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		// subscription is removed while the beta was checked
+		logger.Debug("subscription is removed, status is not saved")
+		return
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to save subscription status")
+		return
+	}
+
+	logger.
+		With(zap.String("prev_status", prevStatus)).
+		With(zap.Stringer("status", status)).
+		Debug("status is changed")
+
+	if eventType != 0 {
+		s.wakeDispatcher()
+	}
+}
+
+// emitCheckFailed emits EventCheckFailed for the beta.
+func (s *srv) emitCheckFailed(b *beta.Beta, err error) {
+	s.emit(Event{
+		Type: EventCheckFailed,
+		Subscription: Subscription{
+			Subscription: repository.Subscription{
+				Link:     b.GetLink(),
+				AppName:  b.GetAppName(),
+				Metadata: castMetadata(b.GetMetadata()),
+			},
+		},
+		Status: beta.StatusUnknown,
+		Err:    err,
+	})
+}
+
+// emit passes event to all registered notifiers.
+func (s *srv) emit(event Event) {
+	s.mu.Lock()
+	notifiers := make([]Notifier, len(s.notifiers))
+	copy(notifiers, s.notifiers)
+	s.mu.Unlock()
+
+	for _, n := range notifiers {
+		err := n.Notify(s.ctx, event)
+		if err == nil {
+			continue
+		}
+
+		userID := event.Subscription.UserID
+		if errors.Is(err, ErrUserUnreachable) && userID != 0 {
+			s.deactivateUser(userID, err)
+			continue
+		}
+
+		s.logger.
+			With(zap.Error(err)).
+			With(zap.Stringer("event", event.Type)).
+			With(zap.Int("user_id", userID)).
+			With(zap.String("link", event.Subscription.Link)).
+			Error("failed to notify")
+	}
+}
+
+// deactivateUser deactivates subscriptions of the user
+// that can not receive notifications anymore
+// and removes the user from subscribers of scheduled checks.
+func (s *srv) deactivateUser(userID int, reason error) {
+	logger := s.logger.
+		With(zap.String("method", "deactivate_user")).
+		With(zap.Int("user_id", userID)).
+		With(zap.NamedError("reason", reason))
+
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	err := s.repo.SetUserBlocked(userID, true)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		logger.With(zap.Error(err)).Error("failed to mark user as blocked")
+	}
+
+	deactivated, err := s.repo.SetUserSubscriptionsActive(userID, false)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to deactivate subscriptions")
+		return
+	}
+
+	s.mu.Lock()
+	var links []string
+	for link, job := range s.jobs {
+		if _, ok := job.subscribers[userID]; ok {
+			links = append(links, link)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, link := range links {
+		s.detach(userID, link)
+	}
+
+	logger.
+		With(zap.Int64("deactivated", deactivated)).
+		Info("user is unreachable, subscriptions are deactivated")
+}
+
 func (s *srv) isSubscribed(userID int, link string) (bool, error) {
 	subs, err := s.repo.GetUserSubscriptions(userID)
 	if err != nil {
@@ -160,6 +1011,53 @@ func (s *srv) isSubscribed(userID int, link string) (bool, error) {
 	return isSubscribed, nil
 }
 
+func castMetadata(md beta.Metadata) repository.BetaMetadata {
+	return repository.BetaMetadata{
+		IconURL:     md.IconURL,
+		Description: md.Description,
+		Platforms:   md.Platforms,
+		Developer:   md.Developer,
+	}
+}
+
+func castBetaMetadata(md repository.BetaMetadata) beta.Metadata {
+	return beta.Metadata{
+		IconURL:     md.IconURL,
+		Description: md.Description,
+		Platforms:   md.Platforms,
+		Developer:   md.Developer,
+	}
+}
+
+func isMetadataEqual(a, b repository.BetaMetadata) bool {
+	if a.IconURL != b.IconURL ||
+		a.Description != b.Description ||
+		a.Developer != b.Developer ||
+		len(a.Platforms) != len(b.Platforms) {
+		return false
+	}
+
+	for i := range a.Platforms {
+		if a.Platforms[i] != b.Platforms[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// activeSubscriptions returns subscriptions that are not deactivated.
+func activeSubscriptions(subs []repository.Subscription) []repository.Subscription {
+	res := make([]repository.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if !sub.Inactive {
+			res = append(res, sub)
+		}
+	}
+
+	return res
+}
+
 func castSubscriptions(repoSubs []repository.Subscription) []Subscription {
 	subs := make([]Subscription, len(repoSubs))
 	for i, sub := range repoSubs {
@@ -0,0 +1,718 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/repository"
+)
+
+const testLink = "https://testflight.apple.com/join/AAAAAAAA"
+
+// newTestService returns service that is never started,
+// so TestFlight is not requested by scheduled checks.
+func newTestService(t *testing.T, repo repository.Repository) *srv {
+	t.Helper()
+
+	s := NewService(repo, Config{Interval: time.Hour}).(*srv)
+	// scheduler is treated as started, so it is never started actually
+	s.isStarted.Store(true)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	return s
+}
+
+// serverTransport sends all requests to the test server.
+type serverTransport struct {
+	url *url.URL
+}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.url.Scheme
+	req.URL.Host = t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testFlight serves TestFlight page of beta in the status.
+type testFlight struct {
+	mu       sync.Mutex
+	status   beta.Status
+	requests int
+}
+
+func (tf *testFlight) setStatus(status beta.Status) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	tf.status = status
+}
+
+func (tf *testFlight) requestsCount() int {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	return tf.requests
+}
+
+func (tf *testFlight) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	tf.requests++
+	switch tf.status {
+	case beta.StatusOpen:
+		_, _ = fmt.Fprint(w, `<title>Join the App beta - TestFlight - Apple</title><p>To join the App beta, install TestFlight.</p>`)
+	case beta.StatusFull:
+		_, _ = fmt.Fprint(w, `<title>Join the App beta - TestFlight - Apple</title><p>This beta is full.</p>`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestFlightClient returns client whose requests are served by handler.
+func newTestFlightClient(t *testing.T, handler http.Handler) *http.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Client{Transport: serverTransport{url: u}}
+}
+
+func (s *srv) isAttached(userID int, link string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[link]
+	if !ok {
+		return false
+	}
+	_, ok = job.subscribers[userID]
+	return ok
+}
+
+func TestSubscribeInvalidLink(t *testing.T) {
+	s := newTestService(t, repository.NewMemoryRepository())
+
+	err := s.Subscribe(context.Background(), 1, "https://example.com")
+	if !errors.Is(err, beta.ErrInvalidTestFlightLink) {
+		t.Fatalf("expected ErrInvalidTestFlightLink, got %v", err)
+	}
+}
+
+func TestSubscribeAlreadySubscribed(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	err := repo.SaveSubscription(repository.Subscription{UserID: 1, Link: testLink, AppName: "App"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	err = s.Subscribe(context.Background(), 1, "testflight.apple.com/join/AAAAAAAA")
+	if !errors.Is(err, ErrAlreadySubscribed) {
+		t.Fatalf("expected ErrAlreadySubscribed, got %v", err)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	err = s.restore(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Unsubscribe(1, testLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.isAttached(1, testLink) {
+		t.Fatal("subscriber is not detached")
+	}
+
+	subs, err := s.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	err = s.Unsubscribe(1, testLink)
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	other := repository.Subscription{UserID: 2, Link: testLink, AppName: "App"}
+	for _, sub := range []repository.Subscription{sub, other} {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := repo.SaveUser(repository.User{ID: 1, CreatedAt: time.Now(), LastSeenAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	for _, sub := range []repository.Subscription{sub, other} {
+		err = s.restore(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.DeleteUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.isAttached(1, testLink) {
+		t.Fatal("subscriber is not detached")
+	}
+	if !s.isAttached(2, testLink) {
+		t.Fatal("subscriber of another user is detached")
+	}
+
+	subs, err := s.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	_, err = s.GetUser(1)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	// check that was started before deletion leaves nothing behind
+	s.notify(sub, beta.StatusOpen)
+	items, err := repo.GetPendingNotifications(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("notification of deleted user is added: %+v", items)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	s := newTestService(t, repo)
+
+	orphaned := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := s.restore(orphaned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := repository.Subscription{UserID: 2, Link: testLink, AppName: "App"}
+	err = repo.SaveSubscription(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.reconcile()
+
+	if s.isAttached(orphaned.UserID, testLink) {
+		t.Fatal("subscriber without stored subscription is not detached")
+	}
+	if !s.isAttached(missing.UserID, testLink) {
+		t.Fatal("stored subscription is not attached")
+	}
+}
+
+func TestMaintainHistory(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	s := NewService(repo, Config{
+		Interval:                  time.Hour,
+		HistoryRetention:          48 * time.Hour,
+		HistoryDownsampleAfter:    24 * time.Hour,
+		HistoryDownsampleInterval: time.Hour,
+	}).(*srv)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	now := time.Now().Truncate(time.Hour)
+	for _, checkedAt := range []time.Time{
+		now.Add(-72 * time.Hour),
+		now.Add(-30 * time.Hour),
+		now.Add(-30*time.Hour + time.Minute),
+		now.Add(-time.Minute),
+		now.Add(-time.Minute + time.Second),
+	} {
+		err := repo.SaveBetaCheck(repository.BetaCheck{
+			Link:      testLink,
+			CheckedAt: checkedAt,
+			Status:    beta.StatusFull.String(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.maintainHistory()
+
+	checks, err := repo.GetBetaChecks(testLink, now.Add(-100*time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 3 {
+		t.Fatalf("unexpected checks: %+v", checks)
+	}
+}
+
+func TestResubscribe(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	other := repository.Subscription{UserID: 2, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	// beta is checked for another user, so TestFlight is not requested
+	err = s.restore(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+	err = s.Resubscribe(context.Background(), Subscription{Subscription: repository.Subscription{
+		UserID:     1,
+		Link:       "AAAAAAAA",
+		LastStatus: beta.StatusOpen.String(),
+		CreatedAt:  createdAt,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.isAttached(1, testLink) {
+		t.Fatal("user is not attached")
+	}
+
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "open" || !subs[0].CreatedAt.Equal(createdAt) {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// user is not notified about open beta again
+	s.notify(subs[0], beta.StatusOpen)
+	items, err := repo.GetPendingNotifications(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+}
+
+func TestDeactivateUnreachableUser(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveUser(repository.User{ID: 1, LastSeenAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	err = s.restore(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RegisterNotifier(NotifierFunc(func(context.Context, Event) error {
+		return fmt.Errorf("%w: blocked", ErrUserUnreachable)
+	}))
+	s.emit(Event{
+		Type:         EventBetaOpened,
+		Subscription: Subscription{Subscription: sub},
+		Status:       beta.StatusOpen,
+	})
+
+	if s.isAttached(1, testLink) {
+		t.Fatal("unreachable user is not detached")
+	}
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || !subs[0].Inactive {
+		t.Fatalf("unexpected subscriptions: %+v", subs)
+	}
+
+	// user stays blocked until subscriptions are reactivated
+	err = s.SaveUser(User{User: repository.User{ID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.GetUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsBlocked {
+		t.Fatal("unreachable user is not blocked")
+	}
+
+	reactivated, err := s.ReactivateUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reactivated != 1 {
+		t.Fatalf("expected 1 reactivated subscription, got %d", reactivated)
+	}
+	if !s.isAttached(1, testLink) {
+		t.Fatal("reactivated user is not attached")
+	}
+	user, err = repo.GetUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsBlocked {
+		t.Fatal("reactivated user is blocked")
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+	s.cfg.DispatchAttempts = 2
+
+	s.notify(sub, beta.StatusOpen)
+
+	// notification waits in outbox until notifier is registered
+	s.dispatch()
+	items, err := repo.GetPendingNotifications(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("unexpected pending notifications: %+v", items)
+	}
+
+	var events []Event
+	s.RegisterNotifier(NotifierFunc(func(_ context.Context, event Event) error {
+		events = append(events, event)
+		if len(events) == 1 {
+			return errors.New("temporary error")
+		}
+		return nil
+	}))
+
+	s.dispatch()
+	items, err = repo.GetPendingNotifications(time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Attempts != 1 {
+		t.Fatalf("failed notification is not retried: %+v", items)
+	}
+
+	s.deliver(items[0])
+	items, err = repo.GetPendingNotifications(time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("delivered notification is pending: %+v", items)
+	}
+	if len(events) != 2 || events[1].Type != EventBetaOpened || events[1].Status != beta.StatusOpen {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestDispatchFailedNotifier(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+	s.cfg.DispatchAttempts = 2
+
+	var delivered, failed int
+	s.RegisterNotifier(NotifierFunc(func(context.Context, Event) error {
+		delivered++
+		return nil
+	}))
+	s.RegisterNotifier(NotifierFunc(func(context.Context, Event) error {
+		failed++
+		if failed == 1 {
+			return errors.New("temporary error")
+		}
+		return nil
+	}))
+
+	s.notify(sub, beta.StatusOpen)
+	s.dispatch()
+	items, err := repo.GetPendingNotifications(time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].NotifierMask != 0b01 {
+		t.Fatalf("delivery to notifier is not recorded: %+v", items)
+	}
+
+	// only failed notifier receives notification again
+	s.deliver(items[0])
+	if delivered != 1 || failed != 2 {
+		t.Fatalf("unexpected deliveries: %d to the first notifier, %d to the second", delivered, failed)
+	}
+	items, err = repo.GetPendingNotifications(time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("delivered notification is pending: %+v", items)
+	}
+}
+
+func TestDispatchUserOrder(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	links := []string{
+		"https://testflight.apple.com/join/AAAAAAAA",
+		"https://testflight.apple.com/join/BBBBBBBB",
+		"https://testflight.apple.com/join/CCCCCCCC",
+	}
+	for _, link := range links {
+		err := repo.SaveSubscription(repository.Subscription{UserID: 1, Link: link, AppName: "App"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newTestService(t, repo)
+	s.cfg.DispatchWorkers = len(links)
+
+	var (
+		mu       sync.Mutex
+		inFlight int
+		notified []string
+	)
+	s.RegisterNotifier(NotifierFunc(func(_ context.Context, event Event) error {
+		mu.Lock()
+		inFlight++
+		concurrent := inFlight > 1
+		mu.Unlock()
+		if concurrent {
+			t.Error("notifications of the user are delivered concurrently")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		notified = append(notified, event.Subscription.Link)
+		mu.Unlock()
+		return nil
+	}))
+
+	for _, link := range links {
+		s.notify(repository.Subscription{UserID: 1, Link: link, AppName: "App"}, beta.StatusOpen)
+	}
+	s.dispatch()
+
+	if !reflect.DeepEqual(notified, links) {
+		t.Fatalf("unexpected order of notifications: %v", notified)
+	}
+}
+
+func TestNotifyRemovedSubscription(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	sub := repository.Subscription{UserID: 1, Link: testLink, AppName: "App"}
+	err := repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, repo)
+
+	// user unsubscribes while the beta is checked
+	err = repo.RemoveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.notify(sub, beta.StatusOpen)
+
+	items, err := repo.GetPendingNotifications(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("notification of removed subscription is added: %+v", items)
+	}
+
+	// status is not left behind, so the next subscription is notified
+	err = repo.SaveSubscription(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs, err := repo.GetUserSubscriptions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].LastStatus != "" {
+		t.Fatalf("status of removed subscription is saved: %+v", subs)
+	}
+}
+
+func TestCheckNotifiesOnStatusChange(t *testing.T) {
+	tf := &testFlight{}
+	repo := repository.NewMemoryRepository()
+	// users share one check of the beta
+	subs := []repository.Subscription{
+		{UserID: 1, Link: testLink, AppName: "App"},
+		{UserID: 2, Link: testLink, AppName: "App"},
+	}
+	for _, sub := range subs {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newTestService(t, repo)
+	s.cfg.HTTPClient = newTestFlightClient(t, tf)
+	s.cfg.NotifyClosed = true
+
+	for _, sub := range subs {
+		err := s.restore(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		events map[int][]EventType // events by user
+	)
+	s.RegisterNotifier(NotifierFunc(func(_ context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events[event.Subscription.UserID] = append(events[event.Subscription.UserID], event.Type)
+		return nil
+	}))
+
+	// each tick is a scheduled check of the beta
+	ticks := []struct {
+		status beta.Status
+		events []EventType
+	}{
+		{beta.StatusFull, nil},
+		{beta.StatusOpen, []EventType{EventBetaOpened}},
+		// beta is still open, users are not notified again
+		{beta.StatusOpen, nil},
+		{beta.StatusFull, []EventType{EventBetaClosed}},
+		{beta.StatusOpen, []EventType{EventBetaOpened}},
+	}
+	for i, tick := range ticks {
+		events = make(map[int][]EventType)
+		tf.setStatus(tick.status)
+		s.check(testLink)
+		s.dispatch()
+
+		if n := tf.requestsCount(); n != i+1 {
+			t.Fatalf("tick %d: expected one request per tick, got %d requests in total", i, n)
+		}
+		for _, sub := range subs {
+			if !reflect.DeepEqual(events[sub.UserID], tick.events) {
+				t.Fatalf("tick %d: expected events %v of user %d, got %v",
+					i, tick.events, sub.UserID, events[sub.UserID])
+			}
+		}
+	}
+}
+
+// hangingHandler does not respond until request is canceled.
+// It sends to started when request is received.
+func hangingHandler(started chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	})
+}
+
+func TestSubscribeRequestTimeout(t *testing.T) {
+	s := newTestService(t, repository.NewMemoryRepository())
+	s.cfg.HTTPClient = newTestFlightClient(t, hangingHandler(nil))
+	s.cfg.RequestTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err := s.Subscribe(context.Background(), 1, testLink)
+	if !errors.Is(err, beta.ErrUnexpected) {
+		t.Fatalf("expected beta.ErrUnexpected, got %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("subscribe is finished in %s", d)
+	}
+}
+
+func TestCloseDuringSubscribe(t *testing.T) {
+	started := make(chan struct{}, 1)
+	s := newTestService(t, repository.NewMemoryRepository())
+	s.cfg.HTTPClient = newTestFlightClient(t, hangingHandler(started))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Subscribe(context.Background(), 1, testLink)
+	}()
+	<-started
+
+	err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscribe is not canceled by close")
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"github.com/go-co-op/gocron"
+)
+
+// linkJob is a scheduled check of one beta.
+// It is shared by all users that subscribed the beta.
+type linkJob struct {
+	job  *gocron.Job
+	beta *beta.Beta
+
+	subscribers map[int]struct{} // user ids of subscribers
+}
+
+func newLinkJob(b *beta.Beta) *linkJob {
+	return &linkJob{
+		beta:        b,
+		subscribers: make(map[int]struct{}),
+	}
+}
+
+// subscribersCount returns count of users that subscribed the beta.
+func (j *linkJob) subscribersCount() int {
+	return len(j.subscribers)
+}
+
+// copySubscribers returns copy of subscribers.
+// It allows to notify subscribers without holding a lock.
+func (j *linkJob) copySubscribers() map[int]struct{} {
+	subscribers := make(map[int]struct{}, len(j.subscribers))
+	for userID := range j.subscribers {
+		subscribers[userID] = struct{}{}
+	}
+
+	return subscribers
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+)
+
+// EventType is type of event that service emits.
+type EventType int
+
+const (
+	// EventBetaOpened is emitted when beta becomes open.
+	EventBetaOpened EventType = iota + 1
+	// EventBetaClosed is emitted when open beta becomes full,
+	// stops accepting testers or disappears.
+	EventBetaClosed
+	// EventCheckFailed is emitted when beta can not be checked.
+	EventCheckFailed
+)
+
+// String returns text representation of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventBetaOpened:
+		return "beta_opened"
+	case EventBetaClosed:
+		return "beta_closed"
+	case EventCheckFailed:
+		return "check_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes change of subscribed beta.
+type Event struct {
+	Type EventType
+
+	// Subscription is subscription that event belongs.
+	// For EventCheckFailed UserID is zero,
+	// because the failure is shared by all subscribers of the beta.
+	Subscription Subscription
+	// Status is new status of the beta.
+	Status beta.Status
+	// Err is reason of EventCheckFailed.
+	Err error
+}
+
+// ErrUserUnreachable may be returned by Notifier
+// if user can not receive notifications anymore,
+// e.g. user has blocked the bot or has been deactivated.
+// Subscriptions of the user are deactivated then
+// until they are reactivated by Service.ReactivateUser.
+var ErrUserUnreachable = errors.New("user is unreachable")
+
+// Notifier delivers events of the service.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NotifierFunc is an adapter to allow the use of functions as notifiers.
+type NotifierFunc func(ctx context.Context, event Event) error
+
+// Notify calls f(ctx, event).
+func (f NotifierFunc) Notify(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
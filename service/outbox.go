@@ -0,0 +1,251 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// dispatchBatchSize is maximum count of notifications
+	// that are loaded from outbox at once.
+	dispatchBatchSize = 100
+	// maxDispatchBackoff limits delay between attempts to deliver notification.
+	maxDispatchBackoff = time.Hour
+	// maxRecordedNotifiers is count of notifiers that fit into
+	// repository.OutboxItem.NotifierMask. Delivery to the rest of notifiers
+	// is not recorded, so they receive notification on every attempt.
+	maxRecordedNotifiers = 63
+)
+
+// runDispatcher delivers pending notifications from outbox
+// until service is closed. Notifications are dispatched
+// every DispatchInterval and right after they are added to outbox.
+func (s *srv) runDispatcher() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.DispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatch()
+
+		select {
+		case <-ticker.C:
+		case <-s.dispatchCh:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// wakeDispatcher makes dispatcher deliver notifications without waiting.
+func (s *srv) wakeDispatcher() {
+	select {
+	case s.dispatchCh <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch delivers pending notifications.
+// Notifications wait in outbox until at least one notifier is registered.
+func (s *srv) dispatch() {
+	s.mu.Lock()
+	hasNotifiers := len(s.notifiers) > 0
+	s.mu.Unlock()
+	if !hasNotifiers {
+		return
+	}
+
+	for s.ctx.Err() == nil {
+		items, err := s.repo.GetPendingNotifications(time.Now(), dispatchBatchSize)
+		if err != nil {
+			s.logger.With(zap.Error(err)).Error("failed to get pending notifications")
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+
+		// notifications of the user are delivered by the same worker
+		// one by one, so they never race each other
+		shards := make([][]repository.OutboxItem, s.cfg.DispatchWorkers)
+		for _, item := range items {
+			i := dispatchShard(item.UserID, len(shards))
+			shards[i] = append(shards[i], item)
+		}
+
+		var wg sync.WaitGroup
+		for _, shard := range shards {
+			if len(shard) == 0 {
+				continue
+			}
+
+			wg.Add(1)
+			go func(items []repository.OutboxItem) {
+				defer wg.Done()
+
+				for _, item := range items {
+					s.deliver(item)
+				}
+			}(shard)
+		}
+		wg.Wait()
+
+		if len(items) < dispatchBatchSize {
+			return
+		}
+	}
+}
+
+// dispatchShard returns worker that delivers notifications of the user.
+func dispatchShard(userID, workers int) int {
+	return int(uint(userID) % uint(workers))
+}
+
+// deliver passes notification to registered notifiers
+// that have not received it yet and saves result of delivery to outbox.
+// Every notifier is tried, so one failed notifier does not delay others.
+func (s *srv) deliver(item repository.OutboxItem) {
+	logger := s.logger.
+		With(zap.String("method", "deliver")).
+		With(zap.Int64("id", item.ID)).
+		With(zap.Int("user_id", item.UserID)).
+		With(zap.String("link", item.Link))
+
+	event, reason, err := s.outboxEvent(item)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get subscription of notification")
+		return
+	}
+	if reason != "" {
+		s.dropNotification(logger, item, reason)
+		return
+	}
+
+	s.mu.Lock()
+	notifiers := make([]Notifier, len(s.notifiers))
+	copy(notifiers, s.notifiers)
+	s.mu.Unlock()
+
+	mask := item.NotifierMask
+	for i, n := range notifiers {
+		bit := notifierBit(i)
+		if mask&bit != 0 {
+			continue
+		}
+
+		notifyErr := n.Notify(s.ctx, event)
+		if notifyErr != nil {
+			if err == nil {
+				err = notifyErr
+			}
+			continue
+		}
+		mask |= bit
+	}
+
+	switch {
+	case err == nil:
+		err = s.repo.MarkNotificationDelivered(item.ID, time.Now())
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to mark notification as delivered")
+			return
+		}
+		logger.
+			With(zap.Duration("latency", time.Since(item.CreatedAt))).
+			Debug("notification is delivered")
+	case s.ctx.Err() != nil:
+		// notification stays pending and is delivered after restart
+		// to notifiers that have not received it
+		logger.Debug("delivery is canceled")
+		if mask == item.NotifierMask {
+			return
+		}
+		err = s.repo.RetryNotification(item.ID, mask, err.Error(), time.Now())
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to save delivery progress")
+		}
+	case errors.Is(err, ErrUserUnreachable):
+		s.deactivateUser(item.UserID, err)
+		s.dropNotification(logger, item, err.Error())
+	case item.Attempts+1 >= s.cfg.DispatchAttempts:
+		logger.With(zap.Error(err)).Error("failed to notify, attempts are exhausted")
+		s.dropNotification(logger, item, err.Error())
+	default:
+		delay := dispatchBackoff(s.cfg.DispatchInterval, item.Attempts)
+		logger.
+			With(zap.Error(err)).
+			With(zap.Duration("delay", delay)).
+			Warn("failed to notify, retrying")
+
+		err = s.repo.RetryNotification(item.ID, mask, err.Error(), time.Now().Add(delay))
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to schedule notification retry")
+		}
+	}
+}
+
+// outboxEvent returns event of the notification.
+// Reason is returned instead if notification should not be delivered anymore.
+func (s *srv) outboxEvent(item repository.OutboxItem) (Event, string, error) {
+	subs, err := s.repo.GetUserSubscriptions(item.UserID)
+	if err != nil {
+		return Event{}, "", err
+	}
+
+	for _, sub := range subs {
+		if sub.Link != item.Link {
+			continue
+		}
+		if sub.Inactive {
+			return Event{}, "subscription is inactive", nil
+		}
+
+		return Event{
+			Type:         EventType(item.EventType),
+			Subscription: Subscription{Subscription: sub},
+			Status:       beta.ParseStatus(item.Status),
+		}, "", nil
+	}
+
+	return Event{}, "subscription is removed", nil
+}
+
+func (s *srv) dropNotification(logger *zap.Logger, item repository.OutboxItem, reason string) {
+	err := s.repo.MarkNotificationDropped(item.ID, reason, time.Now())
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to drop notification")
+		return
+	}
+
+	logger.With(zap.String("reason", reason)).Info("notification is dropped")
+}
+
+// notifierBit returns bit of the i-th registered notifier in outbox item.
+// It is zero if delivery to the notifier can not be recorded.
+func notifierBit(i int) int64 {
+	if i >= maxRecordedNotifiers {
+		return 0
+	}
+
+	return 1 << i
+}
+
+// dispatchBackoff returns delay before the next attempt
+// to deliver notification that has failed attempts.
+func dispatchBackoff(interval time.Duration, attempts int) time.Duration {
+	delay := interval
+	for i := 0; i < attempts && delay < maxDispatchBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxDispatchBackoff {
+		delay = maxDispatchBackoff
+	}
+
+	return delay
+}
@@ -1,23 +1,115 @@
 package service
 
 import (
+	"context"
 	"io"
+	"net/http"
+	"time"
 
-	"git.sr.ht/~mcldresner/tfdog/beta"
 	"git.sr.ht/~mcldresner/tfdog/repository"
 )
 
 // Service describes subscription service.
-// It will be periodically do payload.
+// It will be periodically check betas
+// and notify registered notifiers when beta status is changed.
+// Notifications are stored in outbox before they are delivered,
+// so they are delivered at least once even if service is restarted.
 type Service interface {
-	Subscribe(userID int, link string, payload func(*beta.Beta)) error
+	Subscribe(ctx context.Context, userID int, link string) error
+	// Resubscribe subscribes the user to the beta of removed subscription again.
+	// Last status and creation time of sub are kept, so the user
+	// is not notified again about status they already know.
+	Resubscribe(ctx context.Context, sub Subscription) error
 	Unsubscribe(userID int, link string) error
 	GetUserSubscriptions(userID int) ([]Subscription, error)
+	// GetSubscription returns subscription of the user by its ID.
+	// ErrSubscriptionNotFound is returned if user has no subscription with the ID.
+	GetSubscription(userID int, id int64) (Subscription, error)
+	// GetLastBetaCheck returns the latest check of the beta.
+	// ErrBetaCheckNotFound is returned if beta has not been checked yet.
+	GetLastBetaCheck(link string) (BetaCheck, error)
+	// GetBetaChecks returns checks of the beta made in [from, to) ordered by time.
+	GetBetaChecks(link string, from, to time.Time) ([]BetaCheck, error)
+
+	// Restore schedules checks of already stored subscription.
+	// Unlike Subscribe, it neither saves subscription nor requests TestFlight.
+	Restore(sub Subscription) error
+
+	// ReactivateUser activates subscriptions of the user
+	// that were deactivated because user was unreachable
+	// and clears the blocked mark of the user.
+	// It returns count of reactivated subscriptions.
+	ReactivateUser(userID int) (int, error)
+
+	// SaveUser saves profile of the user that has just interacted with the bot.
+	SaveUser(user User) error
+	// GetUser returns user.
+	// ErrUserNotFound is returned if user has never interacted with the bot.
+	GetUser(userID int) (User, error)
+	// DeleteUser removes the user along with all their subscriptions
+	// and other data tied to the user, checks of their subscriptions are canceled.
+	// Subscriptions made after it returns are kept,
+	// so callers stop their pending subscriptions of the user first.
+	DeleteUser(userID int) error
+
+	// RegisterNotifier adds notifier that receives events of the service.
+	// Outbox records delivery to notifiers by their order,
+	// so they must be registered in the same order on every start.
+	RegisterNotifier(n Notifier)
 
 	io.Closer
 }
 
+// Config is configuration of the service.
+type Config struct {
+	// Interval is interval between checks of each beta.
+	Interval time.Duration
+	// NotifyClosed enables EventBetaClosed events.
+	NotifyClosed bool
+	// HTTPClient is client of requests to TestFlight.
+	// http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+	// RequestTimeout limits each HTTP request to TestFlight.
+	// Zero value means no limit.
+	RequestTimeout time.Duration
+	// CheckTimeout limits whole scheduled check of a beta.
+	// Zero value means no limit.
+	CheckTimeout time.Duration
+	// ReconcileInterval is interval between reconciliations
+	// of scheduled checks with stored subscriptions.
+	// Zero value disables reconciliation.
+	ReconcileInterval time.Duration
+	// HistoryRetention is how long results of checks are kept.
+	// Zero value means forever.
+	HistoryRetention time.Duration
+	// HistoryDownsampleAfter is age of checks that are downsampled,
+	// so only the first check of each status is kept
+	// per beta in every HistoryDownsampleInterval.
+	// Zero value disables downsampling.
+	HistoryDownsampleAfter    time.Duration
+	HistoryDownsampleInterval time.Duration
+	// DispatchInterval is interval between deliveries
+	// of pending notifications from outbox.
+	// Zero value disables delivery of notifications.
+	DispatchInterval time.Duration
+	// DispatchWorkers is count of notifications delivered concurrently.
+	// Notifications of the same user are delivered one by one.
+	DispatchWorkers int
+	// DispatchAttempts is maximum count of attempts to deliver notification.
+	DispatchAttempts int
+}
+
 // Subscription describes user subscription.
 type Subscription struct {
 	repository.Subscription
 }
+
+// BetaCheck describes result of beta check.
+type BetaCheck struct {
+	repository.BetaCheck
+}
+
+// User describes user of the bot.
+type User struct {
+	repository.User
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"io"
 	"time"
 
 	"git.sr.ht/~mcldresner/tfdog/middleware"
@@ -9,17 +10,20 @@ import (
 )
 
 // NewBot constructs new bot.
+// Returned closer stops handlers and must be closed
+// after the bot is stopped and before the service is closed.
 func NewBot(pollerTimeout time.Duration,
 	token string,
 	srv service.Service,
 	helpText, startText string,
-) (*tb.Bot, error) {
+) (*tb.Bot, io.Closer, error) {
 	poller := &tb.LongPoller{
 		Timeout:        pollerTimeout,
 		AllowedUpdates: []string{"message", "callback_query"},
 	}
 	mid := tb.NewMiddlewarePoller(poller, middleware.BuildMiddlewares(
 		middleware.WithValidator(),
+		middleware.WithUserSaver(srv),
 	))
 
 	b, err := tb.NewBot(tb.Settings{
@@ -28,18 +32,32 @@ func NewBot(pollerTimeout time.Duration,
 		Synchronous: false,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	h := newHandler(b, srv)
+	h := newHandler(b, srv, startText)
 
 	b.Handle("/subscribe", h.Subscribe)
+	// links are subscribed from any message including forwarded posts
+	b.Handle(tb.OnText, h.SubscribeLinks)
+	b.Handle(tb.OnPhoto, h.SubscribeLinks)
+	b.Handle(tb.OnVideo, h.SubscribeLinks)
+	b.Handle(tb.OnAnimation, h.SubscribeLinks)
+	b.Handle(tb.OnAudio, h.SubscribeLinks)
+	b.Handle(tb.OnVoice, h.SubscribeLinks)
+	b.Handle(tb.OnDocument, h.Import)
 	b.Handle("/unsubscribe", h.Unsubscribe)
-	b.Handle(tb.OnCallback, h.UnsubscribeInline)
+	b.Handle(&tb.Btn{Unique: unsubscribeUnique}, h.UnsubscribeInline)
+	b.Handle(tb.OnCallback, h.OutdatedCallback)
+	b.Handle("/list", h.List)
+	b.Handle(&tb.Btn{Unique: listPageUnique}, h.ListPage)
+	b.Handle("/export", h.Export)
+	b.Handle("/deleteme", h.DeleteMe)
+	b.Handle(&tb.Btn{Unique: deleteMeUnique}, h.DeleteMeInline)
 
 	b.Handle("/ping", Stringer(b, "pong!"))
 	b.Handle("/help", Stringer(b, helpText))
-	b.Handle("/start", Stringer(b, startText))
+	b.Handle("/start", h.Start)
 
-	return b, nil
+	return b, h, nil
 }
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// deleteMeUnique is unique of buttons of /deleteme.
+	deleteMeUnique = "deleteme"
+	// deleteMeConfirm and deleteMeCancel are callback data of /deleteme buttons.
+	deleteMeConfirm = "yes"
+	deleteMeCancel  = "no"
+)
+
+// DeleteMe asks the user to confirm removal of all their data.
+func (h *handler) DeleteMe(m *tb.Message) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "deleteme"))
+
+	selector := new(tb.ReplyMarkup)
+	selector.Inline(selector.Row(
+		selector.Data("🗑 Delete everything", deleteMeUnique, deleteMeConfirm),
+		selector.Data("Cancel", deleteMeUnique, deleteMeCancel),
+	))
+
+	text := "⚠️ All your subscriptions, their history and settings will be deleted. " +
+		"This can not be undone. Send /export first to keep a copy of your data.\n\n" +
+		"Delete all your data?"
+	_, err := h.bot.Send(m.Sender, text, selector)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to send message")
+		return
+	}
+}
+
+// DeleteMeInline handles buttons of /deleteme message.
+func (h *handler) DeleteMeInline(c *tb.Callback) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "deleteme_inline"))
+
+	resp := &tb.CallbackResponse{
+		CallbackID: c.ID,
+		ShowAlert:  true,
+		Text:       "Something went wrong",
+	}
+	defer func(bot *tb.Bot, c *tb.Callback, resp *tb.CallbackResponse) {
+		err := bot.Respond(c, resp)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to respond")
+		}
+	}(h.bot, c, resp)
+
+	var text string
+	switch c.Data {
+	case deleteMeConfirm:
+		userID := int(c.Sender.ID)
+		// import must not subscribe the user again after data is deleted
+		h.stopImport(userID)
+
+		err := h.srv.DeleteUser(userID)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to delete user")
+			return
+		}
+		text = "🗑 All your data is deleted. Send /start if you want to use the bot again."
+	case deleteMeCancel:
+		text = "Deletion is canceled, your data is kept."
+	default:
+		logger.With(zap.String("data", c.Data)).Warn("invalid callback data")
+		resp.Text = "This message is outdated, send /deleteme again."
+		return
+	}
+
+	// buttons are removed, so data is not deleted twice
+	err := h.edit(c.Message, text, new(tb.ReplyMarkup))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to edit message")
+		return
+	}
+
+	resp.Text = ""
+	resp.ShowAlert = false
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// exportData is everything the bot stores about the user.
+type exportData struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	User          *exportUser          `json:"user,omitempty"`
+	Subscriptions []exportSubscription `json:"subscriptions"`
+}
+
+type exportUser struct {
+	ID           int             `json:"id"`
+	Username     string          `json:"username,omitempty"`
+	LanguageCode string          `json:"language_code,omitempty"`
+	Timezone     string          `json:"timezone,omitempty"`
+	Preferences  json.RawMessage `json:"preferences,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	LastSeenAt   time.Time       `json:"last_seen_at"`
+}
+
+type exportSubscription struct {
+	Link         string        `json:"link"`
+	AppName      string        `json:"app_name"`
+	Developer    string        `json:"developer,omitempty"`
+	Platforms    []string      `json:"platforms,omitempty"`
+	LastStatus   string        `json:"last_status,omitempty"`
+	IsActive     bool          `json:"is_active"`
+	SubscribedAt *time.Time    `json:"subscribed_at,omitempty"`
+	History      []exportCheck `json:"history"`
+}
+
+type exportCheck struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Export sends the user a document with their profile, subscriptions
+// and history of subscribed betas. It is JSON by default,
+// "/export csv" sends subscriptions and history as CSV documents.
+func (h *handler) Export(m *tb.Message) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "export"))
+
+	data, err := h.exportData(int(m.Sender.ID))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to collect user data")
+		h.reply(m, internalErrorText)
+		return
+	}
+
+	var docs []*tb.Document
+	if strings.EqualFold(strings.TrimSpace(m.Payload), "csv") {
+		subs, history, err := exportCSV(data)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to encode csv")
+			h.reply(m, internalErrorText)
+			return
+		}
+		docs = append(docs,
+			exportDocument(subs, "tfdog-subscriptions.csv", "text/csv"),
+			exportDocument(history, "tfdog-history.csv", "text/csv"),
+		)
+	} else {
+		content, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to encode json")
+			h.reply(m, internalErrorText)
+			return
+		}
+		docs = append(docs, exportDocument(content, "tfdog-export.json", "application/json"))
+	}
+
+	for _, doc := range docs {
+		_, err = h.bot.Send(m.Sender, doc)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to send document")
+			return
+		}
+	}
+}
+
+// exportData collects everything the bot stores about the user.
+func (h *handler) exportData(userID int) (exportData, error) {
+	now := time.Now().UTC()
+	data := exportData{
+		ExportedAt:    now,
+		Subscriptions: []exportSubscription{},
+	}
+
+	user, err := h.srv.GetUser(userID)
+	switch {
+	case err == nil:
+		data.User = &exportUser{
+			ID:           user.ID,
+			Username:     user.Username,
+			LanguageCode: user.LanguageCode,
+			Timezone:     user.Timezone,
+			Preferences:  user.Preferences,
+			CreatedAt:    user.CreatedAt,
+			LastSeenAt:   user.LastSeenAt,
+		}
+	case !errors.Is(err, service.ErrUserNotFound):
+		return exportData{}, err
+	}
+
+	subs, err := h.srv.GetUserSubscriptions(userID)
+	if err != nil {
+		return exportData{}, err
+	}
+	sortSubscriptions(subs)
+
+	for _, sub := range subs {
+		// history is shared by all subscribers of the beta,
+		// so only checks made since the user subscribed are exported.
+		// Whole history is exported if the time is unknown.
+		checks, err := h.srv.GetBetaChecks(sub.Link, sub.CreatedAt, now)
+		if err != nil {
+			return exportData{}, err
+		}
+
+		exported := exportSubscription{
+			Link:       sub.Link,
+			AppName:    sub.AppName,
+			Developer:  sub.Metadata.Developer,
+			Platforms:  sub.Metadata.Platforms,
+			LastStatus: sub.LastStatus,
+			IsActive:   !sub.Inactive,
+			History:    make([]exportCheck, len(checks)),
+		}
+		if !sub.CreatedAt.IsZero() {
+			subscribedAt := sub.CreatedAt
+			exported.SubscribedAt = &subscribedAt
+		}
+		for i, check := range checks {
+			exported.History[i] = exportCheck{
+				CheckedAt:  check.CheckedAt,
+				Status:     check.Status,
+				StatusCode: check.StatusCode,
+				LatencyMS:  check.Latency.Milliseconds(),
+				Error:      check.Error,
+			}
+		}
+
+		data.Subscriptions = append(data.Subscriptions, exported)
+	}
+
+	return data, nil
+}
+
+// exportCSV encodes subscriptions and their history as two CSV documents.
+func exportCSV(data exportData) (subs, history []byte, err error) {
+	var subsBuf, historyBuf bytes.Buffer
+	subsW := csv.NewWriter(&subsBuf)
+	historyW := csv.NewWriter(&historyBuf)
+
+	err = subsW.Write([]string{"link", "app_name", "developer", "platforms", "last_status", "is_active", "subscribed_at"})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = historyW.Write([]string{"link", "checked_at", "status", "status_code", "latency_ms", "error"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, sub := range data.Subscriptions {
+		var subscribedAt string
+		if sub.SubscribedAt != nil {
+			subscribedAt = sub.SubscribedAt.Format(time.RFC3339)
+		}
+
+		err = subsW.Write([]string{
+			sub.Link,
+			sub.AppName,
+			sub.Developer,
+			strings.Join(sub.Platforms, ", "),
+			sub.LastStatus,
+			strconv.FormatBool(sub.IsActive),
+			subscribedAt,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, check := range sub.History {
+			err = historyW.Write([]string{
+				sub.Link,
+				check.CheckedAt.Format(time.RFC3339),
+				check.Status,
+				strconv.Itoa(check.StatusCode),
+				strconv.FormatInt(check.LatencyMS, 10),
+				check.Error,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	subsW.Flush()
+	historyW.Flush()
+	if err = subsW.Error(); err != nil {
+		return nil, nil, err
+	}
+	if err = historyW.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	return subsBuf.Bytes(), historyBuf.Bytes(), nil
+}
+
+func exportDocument(content []byte, fileName, mime string) *tb.Document {
+	return &tb.Document{
+		File:     tb.FromReader(bytes.NewReader(content)),
+		FileName: fileName,
+		MIME:     mime,
+	}
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/service"
+)
+
+func TestExportCSV(t *testing.T) {
+	subscribedAt := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+	data := exportData{
+		Subscriptions: []exportSubscription{
+			{
+				Link:         "https://testflight.apple.com/join/AAAAAAAA",
+				AppName:      "App, with comma",
+				Developer:    "Dev",
+				Platforms:    []string{"iOS", "macOS"},
+				LastStatus:   "open",
+				IsActive:     true,
+				SubscribedAt: &subscribedAt,
+				History: []exportCheck{
+					{
+						CheckedAt:  time.Date(2022, 1, 2, 15, 4, 0, 0, time.UTC),
+						Status:     "open",
+						StatusCode: 200,
+						LatencyMS:  120,
+					},
+					{
+						CheckedAt: time.Date(2022, 1, 2, 16, 4, 0, 0, time.UTC),
+						Status:    "unknown",
+						LatencyMS: 5000,
+						Error:     "timeout",
+					},
+				},
+			},
+			{
+				Link:    "https://testflight.apple.com/join/BBBBBBBB",
+				AppName: "Other",
+				History: []exportCheck{},
+			},
+		},
+	}
+
+	subs, history, err := exportCSV(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSubs := "link,app_name,developer,platforms,last_status,is_active,subscribed_at\n" +
+		"https://testflight.apple.com/join/AAAAAAAA,\"App, with comma\",Dev,\"iOS, macOS\",open,true,2022-01-01T12:30:00Z\n" +
+		"https://testflight.apple.com/join/BBBBBBBB,Other,,,,false,\n"
+	if string(subs) != wantSubs {
+		t.Errorf("unexpected subscriptions:\n%s", subs)
+	}
+
+	wantHistory := "link,checked_at,status,status_code,latency_ms,error\n" +
+		"https://testflight.apple.com/join/AAAAAAAA,2022-01-02T15:04:00Z,open,200,120,\n" +
+		"https://testflight.apple.com/join/AAAAAAAA,2022-01-02T16:04:00Z,unknown,0,5000,timeout\n"
+	if string(history) != wantHistory {
+		t.Errorf("unexpected history:\n%s", history)
+	}
+}
+
+func TestExportData(t *testing.T) {
+	const (
+		linkA = "https://testflight.apple.com/join/AAAAAAAA"
+		linkB = "https://testflight.apple.com/join/BBBBBBBB"
+		linkC = "https://testflight.apple.com/join/CCCCCCCC"
+	)
+	subscribedAt := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	repo := repository.NewMemoryRepository()
+	for _, sub := range []repository.Subscription{
+		{UserID: 1, Link: linkA, AppName: "A", CreatedAt: subscribedAt},
+		// subscription saved before creation time was stored
+		{UserID: 1, Link: linkB, AppName: "B"},
+		{UserID: 1, Link: linkC, AppName: "C", CreatedAt: subscribedAt},
+		{UserID: 2, Link: linkA, AppName: "A", CreatedAt: subscribedAt.Add(-time.Hour)},
+	} {
+		err := repo.SaveSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := repo.SaveSubscriptionStatus(repository.Subscription{UserID: 1, Link: linkA, LastStatus: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveBetaMetadata(linkA, repository.BetaMetadata{Developer: "Dev", Platforms: []string{"iOS"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []repository.BetaCheck{
+		// checked for another user before the user subscribed
+		{Link: linkA, CheckedAt: subscribedAt.Add(-time.Minute), Status: "full", StatusCode: 200},
+		{Link: linkA, CheckedAt: subscribedAt.Add(time.Minute), Status: "open", StatusCode: 200, Latency: 120 * time.Millisecond},
+		{Link: linkB, CheckedAt: subscribedAt.Add(-time.Minute), Status: "unknown", Error: "timeout"},
+	} {
+		err = repo.SaveBetaCheck(check)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = repo.SaveUser(repository.User{ID: 1, Username: "user", LastSeenAt: subscribedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SaveUserPreferences(1, "Europe/Berlin", []byte(`{"quiet":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := service.NewService(repo, service.Config{Interval: time.Hour})
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+	h := newHandler(nil, srv, "")
+
+	data, err := h.exportData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.ExportedAt.IsZero() {
+		t.Error("export time is not set")
+	}
+	data.ExportedAt = time.Time{}
+
+	expected := exportData{
+		User: &exportUser{
+			ID:          1,
+			Username:    "user",
+			Timezone:    "Europe/Berlin",
+			Preferences: json.RawMessage(`{"quiet":true}`),
+			CreatedAt:   subscribedAt,
+			LastSeenAt:  subscribedAt,
+		},
+		Subscriptions: []exportSubscription{
+			{
+				Link:         linkA,
+				AppName:      "A",
+				Developer:    "Dev",
+				Platforms:    []string{"iOS"},
+				LastStatus:   "open",
+				IsActive:     true,
+				SubscribedAt: &subscribedAt,
+				History: []exportCheck{
+					{CheckedAt: subscribedAt.Add(time.Minute), Status: "open", StatusCode: 200, LatencyMS: 120},
+				},
+			},
+			{
+				Link:     linkB,
+				AppName:  "B",
+				IsActive: true,
+				History: []exportCheck{
+					{CheckedAt: subscribedAt.Add(-time.Minute), Status: "unknown", Error: "timeout"},
+				},
+			},
+			{
+				Link:         linkC,
+				AppName:      "C",
+				IsActive:     true,
+				SubscribedAt: &subscribedAt,
+				History:      []exportCheck{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		got, _ := json.MarshalIndent(data, "", "  ")
+		t.Fatalf("unexpected export:\n%s", got)
+	}
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const maxDescriptionLen = 200
+
+var markdownReplacer = strings.NewReplacer(
+	"_", "\\_",
+	"*", "\\*",
+	"`", "\\`",
+	"[", "\\[",
+)
+
+// escapeMarkdown escapes text to be sent in markdown mode.
+func escapeMarkdown(text string) string {
+	return markdownReplacer.Replace(text)
+}
+
+// betaDetails returns short description of beta app
+// like "by Developer · iOS, macOS".
+// It is empty if nothing is known about the app.
+func betaDetails(developer string, platforms []string) string {
+	var parts []string
+	if developer != "" {
+		parts = append(parts, "by "+developer)
+	}
+	if len(platforms) > 0 {
+		parts = append(parts, strings.Join(platforms, ", "))
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// truncate cuts text to n runes.
+func truncate(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
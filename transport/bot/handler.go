@@ -1,129 +1,108 @@
 package bot
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
+	"git.sr.ht/~mcldresner/tfdog/beta"
 	"git.sr.ht/~mcldresner/tfdog/service"
 	"go.uber.org/zap"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
+// linkExample shows users what TestFlight link looks like.
+const linkExample = "https://testflight.apple.com/join/XXXXXXXX"
+
+// internalErrorText is reply to request that is failed because of the bot.
+const internalErrorText = "Something went wrong on our side. Please try again later."
+
 type handler struct {
-	bot *tb.Bot
-	srv service.Service
+	bot       *tb.Bot
+	srv       service.Service
+	startText string
+
+	// ctx is passed to requests to the service,
+	// it is canceled when handler is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	imports map[int]*userImport // imports in progress by user
+	wg      sync.WaitGroup      // imports running in background
 }
 
-func newHandler(bot *tb.Bot, srv service.Service) *handler {
-	return &handler{bot: bot, srv: srv}
+// userImport is import of the user running in background.
+type userImport struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when import is finished
 }
 
-func (h *handler) Subscribe(m *tb.Message) {
-	logger := zap.L().
-		Named("handler").
-		With(zap.String("command", "subscribe"))
-
-	payload := NewBetaPayload(h.bot, m.Sender)
-	err := h.srv.Subscribe(int(m.Sender.ID), m.Payload, payload)
-	if err != nil {
-		if errors.Is(err, service.ErrAlreadySubscribed) {
-			_, err = h.bot.Send(m.Sender, "You have already subscribed this beta.")
-			if err != nil {
-				logger.With(zap.Error(err)).Error("failed to send message")
-				return
-			}
-		}
-		return
-	}
-
-	text := "⚡️ You have been subscribed the beta"
-	_, err = h.bot.Send(
-		m.Sender,
-		text,
-		tb.NoPreview,
-		tb.ModeMarkdown,
-	)
-	if err != nil {
-		logger.With(zap.Error(err)).Error("failed to send message")
-		return
+func newHandler(bot *tb.Bot, srv service.Service, startText string) *handler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &handler{
+		bot:       bot,
+		srv:       srv,
+		startText: startText,
+		ctx:       ctx,
+		cancel:    cancel,
+		imports:   make(map[int]*userImport),
 	}
 }
 
-func (h *handler) Unsubscribe(m *tb.Message) {
-	logger := zap.L().
-		Named("handler").
-		With(zap.String("command", "unsubscribe"))
-
-	keyboard, err := h.generateDeletionKeyboard(int(m.Sender.ID))
-	if err != nil {
-		return
-	}
-
-	_, err = h.bot.Send(m.Sender, "List of subscriptions:", keyboard)
-	if err != nil {
-		logger.With(zap.Error(err)).Error("failed to send message")
-		return
-	}
+// Close cancels requests of the handler to the service
+// and waits for imports running in background.
+// It must be called after the bot is stopped
+// and before the service is closed.
+func (h *handler) Close() error {
+	h.mu.Lock()
+	h.cancel()
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	return nil
 }
 
-func (h *handler) UnsubscribeInline(c *tb.Callback) {
+// Start greets the user and reactivates subscriptions
+// that were deactivated while user had blocked the bot.
+func (h *handler) Start(m *tb.Message) {
 	logger := zap.L().
 		Named("handler").
-		With(zap.String("command", "unsubscribe_inline"))
+		With(zap.String("command", "start"))
 
-	resp := &tb.CallbackResponse{
-		CallbackID: c.ID,
-		ShowAlert:  true,
-		Text:       "Something went wrong",
-	}
-	defer func(bot *tb.Bot, c *tb.Callback, resp *tb.CallbackResponse) {
-		err := bot.Respond(c, resp)
-		if err != nil {
-			logger.With(zap.Error(err)).Error("failed to respond")
-		}
-	}(h.bot, c, resp)
-
-	err := h.srv.Unsubscribe(int(c.Sender.ID), c.Data)
+	text := h.startText
+	reactivated, err := h.srv.ReactivateUser(int(m.Sender.ID))
 	if err != nil {
-		return
+		logger.With(zap.Error(err)).Error("failed to reactivate user")
 	}
-	resp.Text = "Successfully unsubscribed"
-	resp.ShowAlert = false
-
-	keyboard, err := h.generateDeletionKeyboard(int(c.Sender.ID))
-	if err != nil {
-		return
+	if reactivated > 0 {
+		text += fmt.Sprintf("\n\n🔔 Welcome back! %d of your subscriptions are active again.", reactivated)
 	}
 
-	_, err = h.bot.EditReplyMarkup(c.Message, keyboard)
+	_, err = h.bot.Send(m.Sender, text)
 	if err != nil {
-		logger.With(zap.Error(err)).Error("failed to edit reply markup")
+		logger.With(zap.Error(err)).Error("failed to send message")
 		return
 	}
 }
 
-func (h *handler) generateDeletionKeyboard(userID int) (*tb.ReplyMarkup, error) {
-	subs, err := h.srv.GetUserSubscriptions(userID)
-	if err != nil {
-		return nil, err
+// subscribeErrorText returns reply to /subscribe that is failed with the error.
+func subscribeErrorText(payload string, err error) string {
+	switch {
+	case errors.Is(err, service.ErrAlreadySubscribed):
+		return "You have already subscribed this beta."
+	case errors.Is(err, beta.ErrInvalidTestFlightLink) && strings.TrimSpace(payload) == "":
+		return "Send a link to the beta like this:\n/subscribe " + linkExample
+	case errors.Is(err, beta.ErrInvalidTestFlightLink):
+		return "This is not a TestFlight link or the beta does not exist anymore. " +
+			"Send a link like " + linkExample
+	case errors.Is(err, beta.ErrStatusNotOK):
+		return "TestFlight is not available right now. Please try again later."
+	case errors.Is(err, beta.ErrUnexpected), errors.Is(err, context.DeadlineExceeded):
+		return "Failed to reach TestFlight. Please try again later."
+	default:
+		return internalErrorText
 	}
-
-	keyboard := generateReplyMarkup(subs)
-	return keyboard, nil
-}
-
-func generateReplyMarkup(subs []service.Subscription) *tb.ReplyMarkup {
-	selector := new(tb.ReplyMarkup)
-	rows := make([]tb.Row, len(subs))
-	for i, val := range subs {
-		rows[i] = selector.Row(
-			selector.Data(
-				val.AppName,
-				"",
-				val.Link,
-			),
-		)
-	}
-
-	selector.Inline(rows...)
-	return selector
 }
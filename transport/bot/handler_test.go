@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+)
+
+func TestSubscribeErrorText(t *testing.T) {
+	tests := []struct {
+		payload string
+		err     error
+		want    string
+	}{
+		{"link", service.ErrAlreadySubscribed, "already subscribed"},
+		{"", beta.ErrInvalidTestFlightLink, "/subscribe " + linkExample},
+		{"https://example.com", beta.ErrInvalidTestFlightLink, linkExample},
+		{"link", beta.ErrStatusNotOK, "TestFlight is not available"},
+		{"link", fmt.Errorf("%w: connection refused", beta.ErrUnexpected), "Failed to reach TestFlight"},
+		{"link", context.DeadlineExceeded, "Failed to reach TestFlight"},
+		{"link", errors.New("database is locked"), "on our side"},
+	}
+
+	for _, tt := range tests {
+		got := subscribeErrorText(tt.payload, tt.err)
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("subscribeErrorText(%q, %v) = %q, want it to contain %q", tt.payload, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// maxImportSize is maximum size of imported file.
+	maxImportSize = 1 << 20
+	// maxImportLinks is maximum count of links imported from one file.
+	maxImportLinks = 200
+	// importProgressInterval is minimum interval between edits of progress message.
+	importProgressInterval = 3 * time.Second
+	// maxReportLinks is maximum count of links listed in each section of import report.
+	maxReportLinks = 20
+)
+
+// importFormatText is reply to document that can not be imported.
+const importFormatText = "Send links in a text, CSV or JSON file."
+
+var (
+	// errImportFormat is returned if format of imported file is not supported.
+	errImportFormat = errors.New("unsupported format of file")
+
+	// errImportInProgress is returned if previous import of the user is not finished.
+	errImportInProgress = errors.New("previous import is in progress")
+
+	// candidateRe matches everything that looks like TestFlight link,
+	// so malformed links are reported too.
+	candidateRe = regexp.MustCompile(`(?i)(?:(?:https?|itms-beta)://)?testflight\.apple\.com/join/[^\s"'<>()\[\]{},;|]*`)
+)
+
+// importReport is result of import.
+type importReport struct {
+	added     []string
+	duplicate []string // already subscribed or repeated in the file
+	invalid   []string // malformed links or betas that do not exist
+	failed    []string // links that can be imported again later
+	skipped   int      // links over maxImportLinks
+}
+
+// Import subscribes the user to TestFlight links of uploaded text, CSV or JSON file.
+// Links are subscribed in background, progress message is edited as it goes
+// and the report is sent when import is finished.
+// Links in caption are subscribed instead if file can not be imported.
+func (h *handler) Import(m *tb.Message) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "import"))
+
+	doc := m.Document
+	if _, err := importFormat(doc); err != nil {
+		h.subscribeCaption(m, importFormatText)
+		return
+	}
+	if doc.FileSize > maxImportSize {
+		h.reply(m, fmt.Sprintf("The file is too large. Up to %d KB files are imported.", maxImportSize>>10))
+		return
+	}
+
+	links, invalid, err := h.readImport(doc)
+	if errors.Is(err, errImportFormat) {
+		h.subscribeCaption(m, importFormatText)
+		return
+	}
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to read file")
+		h.reply(m, internalErrorText)
+		return
+	}
+	if len(links) == 0 && len(invalid) == 0 {
+		h.subscribeCaption(m, "There are no TestFlight links in the file.")
+		return
+	}
+
+	userID := int(m.Sender.ID)
+	ctx, err := h.startImport(userID)
+	if errors.Is(err, errImportInProgress) {
+		h.reply(m, "Your previous import is still in progress. Please wait until it is finished.")
+		return
+	}
+	if err != nil {
+		h.reply(m, "The bot is restarting. Please send the file again in a minute.")
+		return
+	}
+
+	links, repeated := uniqueLinks(links)
+	var skipped int
+	if len(links) > maxImportLinks {
+		skipped = len(links) - maxImportLinks
+		links = links[:maxImportLinks]
+	}
+
+	progress, err := h.bot.Send(m.Sender, formatImportProgress(0, len(links)))
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to send message")
+		h.finishImport(userID)
+		return
+	}
+
+	go func() {
+		defer h.finishImport(userID)
+
+		report := h.importLinks(ctx, userID, links, progress)
+		report.duplicate = append(report.duplicate, repeated...)
+		report.invalid = append(invalid, report.invalid...)
+		report.skipped = skipped
+
+		err := h.edit(progress, formatImportProgress(len(links), len(links)), nil)
+		if err != nil {
+			logger.With(zap.Error(err)).Warn("failed to edit progress message")
+		}
+		h.reply(m, formatImportReport(report))
+	}()
+}
+
+// subscribeCaption subscribes the user to links in caption of the document
+// that is not imported. Text is sent if caption has no links.
+func (h *handler) subscribeCaption(m *tb.Message, text string) {
+	links := messageLinks(m)
+	if len(links) == 0 {
+		h.reply(m, text)
+		return
+	}
+
+	h.subscribeLinks(m, links)
+}
+
+// importFormat reports whether the document is JSON file.
+// errImportFormat is returned if document is neither text nor JSON.
+func importFormat(doc *tb.Document) (isJSON bool, err error) {
+	ext := strings.ToLower(path.Ext(doc.FileName))
+	isJSON = ext == ".json" || doc.MIME == "application/json"
+	isText := ext == ".txt" || ext == ".csv" || strings.HasPrefix(doc.MIME, "text/")
+	if !isJSON && !isText {
+		return false, errImportFormat
+	}
+
+	return isJSON, nil
+}
+
+// readImport downloads the document and extracts links from it.
+// Malformed links are returned as invalid.
+// errImportFormat is returned if document is neither text nor JSON.
+func (h *handler) readImport(doc *tb.Document) (links, invalid []string, err error) {
+	isJSON, err := importFormat(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := h.bot.GetFile(&doc.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func(file io.ReadCloser) {
+		_ = file.Close()
+	}(file)
+
+	content, err := ioutil.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !isJSON {
+		links, invalid = findCandidates(string(content))
+		return links, invalid, nil
+	}
+
+	var v interface{}
+	err = json.Unmarshal(content, &v)
+	if err != nil {
+		return nil, nil, errImportFormat
+	}
+
+	// slashes may be escaped in JSON, so links are searched in decoded strings
+	for _, s := range jsonStrings(v) {
+		l, i := findCandidates(s)
+		links = append(links, l...)
+		invalid = append(invalid, i...)
+	}
+	return links, invalid, nil
+}
+
+// importLinks subscribes the user to the links
+// and edits progress message as it goes.
+// Import is stopped when context is canceled.
+func (h *handler) importLinks(ctx context.Context, userID int, links []string, progress *tb.Message) importReport {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "import")).
+		With(zap.Int("user_id", userID))
+
+	var report importReport
+	lastProgress := time.Now()
+	for i, link := range links {
+		if ctx.Err() != nil {
+			// bot is stopping or user data is deleted,
+			// the rest is imported again by the user
+			report.failed = append(report.failed, links[i:]...)
+			break
+		}
+
+		if time.Since(lastProgress) >= importProgressInterval {
+			err := h.edit(progress, formatImportProgress(i, len(links)), nil)
+			if err != nil {
+				logger.With(zap.Error(err)).Warn("failed to edit progress message")
+			}
+			lastProgress = time.Now()
+		}
+
+		err := h.srv.Subscribe(ctx, userID, link)
+		switch {
+		case err == nil:
+			report.added = append(report.added, link)
+		case errors.Is(err, service.ErrAlreadySubscribed):
+			report.duplicate = append(report.duplicate, link)
+		case errors.Is(err, beta.ErrInvalidTestFlightLink):
+			report.invalid = append(report.invalid, link)
+		default:
+			report.failed = append(report.failed, link)
+		}
+	}
+
+	logger.
+		With(zap.Int("added", len(report.added))).
+		With(zap.Int("duplicate", len(report.duplicate))).
+		With(zap.Int("invalid", len(report.invalid))).
+		With(zap.Int("failed", len(report.failed))).
+		Info("links are imported")
+
+	return report
+}
+
+// startImport marks that import of the user is in progress,
+// so handler waits for it on close.
+// Returned context of the import is canceled on close or by stopImport.
+// errImportInProgress is returned if another import of the user is not finished yet,
+// error of context is returned if handler is closed.
+func (h *handler) startImport(userID int) (context.Context, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := h.imports[userID]; ok {
+		return nil, errImportInProgress
+	}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	h.imports[userID] = &userImport{cancel: cancel, done: make(chan struct{})}
+	h.wg.Add(1)
+	return ctx, nil
+}
+
+func (h *handler) finishImport(userID int) {
+	h.mu.Lock()
+	imp := h.imports[userID]
+	delete(h.imports, userID)
+	h.mu.Unlock()
+
+	imp.cancel()
+	close(imp.done)
+	h.wg.Done()
+}
+
+// stopImport cancels import of the user and waits for it to finish.
+// It does nothing if user has no import in progress.
+func (h *handler) stopImport(userID int) {
+	h.mu.Lock()
+	imp, ok := h.imports[userID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	imp.cancel()
+	<-imp.done
+}
+
+// findCandidates returns canonical TestFlight links found in the text
+// and malformed links that look like TestFlight ones.
+// Links are returned in order of occurrence including repeated ones.
+func findCandidates(text string) (links, invalid []string) {
+	for _, candidate := range candidateRe.FindAllString(text, -1) {
+		candidate = strings.TrimRight(candidate, ".!?:")
+
+		link, err := beta.ParseLink(candidate)
+		if err != nil {
+			invalid = append(invalid, candidate)
+			continue
+		}
+		links = append(links, link)
+	}
+
+	return links, invalid
+}
+
+// uniqueLinks returns links without repeats
+// and links that are repeated in order of occurrence.
+func uniqueLinks(links []string) (unique, repeated []string) {
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if seen[link] {
+			repeated = append(repeated, link)
+			continue
+		}
+
+		seen[link] = true
+		unique = append(unique, link)
+	}
+
+	return unique, repeated
+}
+
+// jsonStrings returns all string values of decoded JSON.
+func jsonStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var res []string
+		for _, item := range v {
+			res = append(res, jsonStrings(item)...)
+		}
+		return res
+	case map[string]interface{}:
+		// keys are sorted, so links are found in the same order every time
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var res []string
+		for _, key := range keys {
+			res = append(res, jsonStrings(v[key])...)
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+func formatImportProgress(done, total int) string {
+	if done == total {
+		return fmt.Sprintf("✅ Import is finished: %d of %d links are processed.", done, total)
+	}
+
+	return fmt.Sprintf("⏳ Importing links: %d of %d are processed…", done, total)
+}
+
+// formatImportReport returns markdown report of import.
+func formatImportReport(r importReport) string {
+	var sb strings.Builder
+	sb.WriteString("📥 *Import report*")
+
+	sections := []struct {
+		title string
+		links []string
+	}{
+		{"✅ Added", r.added},
+		{"☑️ Already subscribed", r.duplicate},
+		{"❌ Invalid", r.invalid},
+		{"⚠️ Failed, try to import them later", r.failed},
+	}
+	for _, section := range sections {
+		if len(section.links) == 0 {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&sb, "\n\n%s: %d", section.title, len(section.links))
+		for i, link := range section.links {
+			if i == maxReportLinks {
+				_, _ = fmt.Fprintf(&sb, "\n…and %d more", len(section.links)-maxReportLinks)
+				break
+			}
+			sb.WriteString("\n" + escapeMarkdown(truncate(link, maxDescriptionLen)))
+		}
+	}
+
+	if r.skipped > 0 {
+		_, _ = fmt.Fprintf(&sb, "\n\n%d more links are skipped, up to %d links are imported at once. "+
+			"Send the rest in another file.", r.skipped, maxImportLinks)
+	}
+
+	return sb.String()
+}
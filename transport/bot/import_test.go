@@ -0,0 +1,348 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/service"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// blockingService subscribes links until context is canceled.
+// Other methods of service.Service must not be called.
+type blockingService struct {
+	service.Service
+
+	started chan struct{}
+
+	mu          sync.Mutex
+	subscribing bool
+	// deletedWhileSubscribing is set if DeleteUser is called
+	// while subscription is in progress.
+	deletedWhileSubscribing bool
+}
+
+func (s *blockingService) Subscribe(ctx context.Context, _ int, _ string) error {
+	s.mu.Lock()
+	s.subscribing = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.subscribing = false
+		s.mu.Unlock()
+	}()
+
+	s.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingService) DeleteUser(int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deletedWhileSubscribing = s.subscribing
+	return nil
+}
+
+// newFileBot returns bot that downloads files with the content.
+func newFileBot(t *testing.T, content string) *tb.Bot {
+	t.Helper()
+
+	return newTestBot(t, func(w http.ResponseWriter, n int) {
+		if n == 1 {
+			_, _ = fmt.Fprint(w, `{"ok":true,"result":{"file_id":"id","file_path":"documents/file"}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, content)
+	})
+}
+
+func TestReadImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      tb.Document
+		content  string
+		links    []string
+		invalid  []string
+		expected error
+	}{
+		{
+			name: "text",
+			doc:  tb.Document{FileName: "betas.txt", MIME: "text/plain"},
+			content: "My betas:\n" +
+				"https://testflight.apple.com/join/AAAAAAAA.\n" +
+				"(testflight.apple.com/join/BBBBBBBB)\n" +
+				"https://testflight.apple.com/join/short\n",
+			links:   []string{"https://testflight.apple.com/join/AAAAAAAA", "https://testflight.apple.com/join/BBBBBBBB"},
+			invalid: []string{"https://testflight.apple.com/join/short"},
+		},
+		{
+			name: "csv",
+			doc:  tb.Document{FileName: "betas.csv", MIME: "text/csv"},
+			content: "name,link\n" +
+				"A,https://testflight.apple.com/join/AAAAAAAA\n" +
+				"\"B, beta\",\"https://testflight.apple.com/join/BBBBBBBB?ref=1\"\n",
+			links: []string{"https://testflight.apple.com/join/AAAAAAAA", "https://testflight.apple.com/join/BBBBBBBB"},
+		},
+		{
+			name:    "json",
+			doc:     tb.Document{FileName: "betas.json", MIME: "application/json"},
+			content: `{"subscriptions":[{"link":"https:\/\/testflight.apple.com\/join\/AAAAAAAA"}],"other":"itms-beta://testflight.apple.com/join/BBBBBBBB"}`,
+			links:   []string{"https://testflight.apple.com/join/BBBBBBBB", "https://testflight.apple.com/join/AAAAAAAA"},
+		},
+		{
+			name:     "malformed json",
+			doc:      tb.Document{FileName: "betas.json"},
+			content:  `{"link":`,
+			expected: errImportFormat,
+		},
+		{
+			name:     "image",
+			doc:      tb.Document{FileName: "betas.png", MIME: "image/png"},
+			expected: errImportFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHandler(newFileBot(t, tt.content), nil, "")
+
+			links, invalid, err := h.readImport(&tt.doc)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected error %v, got %v", tt.expected, err)
+			}
+			if !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("unexpected links: %v", links)
+			}
+			if !reflect.DeepEqual(invalid, tt.invalid) {
+				t.Errorf("unexpected invalid links: %v", invalid)
+			}
+		})
+	}
+}
+
+func TestUniqueLinks(t *testing.T) {
+	unique, repeated := uniqueLinks([]string{"a", "b", "a", "c", "b"})
+	if !reflect.DeepEqual(unique, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected unique links: %v", unique)
+	}
+	if !reflect.DeepEqual(repeated, []string{"a", "b"}) {
+		t.Errorf("unexpected repeated links: %v", repeated)
+	}
+}
+
+func TestFormatImportReport(t *testing.T) {
+	var added []string
+	for i := 0; i < maxReportLinks+5; i++ {
+		added = append(added, fmt.Sprintf("https://testflight.apple.com/join/A%07d", i))
+	}
+
+	text := formatImportReport(importReport{
+		added:     added,
+		duplicate: []string{"https://testflight.apple.com/join/BBBBBBBB"},
+		invalid:   []string{"testflight.apple.com/join/bad_code"},
+		skipped:   2,
+	})
+
+	for _, want := range []string{
+		fmt.Sprintf("✅ Added: %d", len(added)),
+		"…and 5 more",
+		"☑️ Already subscribed: 1\nhttps://testflight.apple.com/join/BBBBBBBB",
+		"❌ Invalid: 1\ntestflight.apple.com/join/bad\\_code",
+		"2 more links are skipped",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Failed") {
+		t.Errorf("report contains empty section:\n%s", text)
+	}
+}
+
+func TestCloseWaitsForImport(t *testing.T) {
+	srv := &blockingService{started: make(chan struct{}, 1)}
+	h := newHandler(nil, srv, "")
+
+	ctx, err := h.startImport(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.startImport(1)
+	if !errors.Is(err, errImportInProgress) {
+		t.Fatalf("expected errImportInProgress, got %v", err)
+	}
+
+	links := []string{
+		"https://testflight.apple.com/join/AAAAAAAA",
+		"https://testflight.apple.com/join/BBBBBBBB",
+	}
+	reports := make(chan importReport, 1)
+	go func() {
+		defer h.finishImport(1)
+		reports <- h.importLinks(ctx, 1, links, nil)
+	}()
+	<-srv.started
+
+	closed := make(chan struct{})
+	go func() {
+		_ = h.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("handler is not closed")
+	}
+
+	// import is finished before handler is closed,
+	// links that are not subscribed are reported as failed
+	select {
+	case report := <-reports:
+		if !reflect.DeepEqual(report.failed, links) {
+			t.Fatalf("unexpected failed links: %v", report.failed)
+		}
+	default:
+		t.Fatal("handler is closed before import is finished")
+	}
+
+	_, err = h.startImport(2)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDeleteMeStopsImport(t *testing.T) {
+	b, _ := newSendBot(t)
+	srv := &blockingService{started: make(chan struct{}, 1)}
+	h := newHandler(b, srv, "")
+	defer func() {
+		_ = h.Close()
+	}()
+
+	ctx, err := h.startImport(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := []string{
+		"https://testflight.apple.com/join/AAAAAAAA",
+		"https://testflight.apple.com/join/BBBBBBBB",
+	}
+	reports := make(chan importReport, 1)
+	go func() {
+		defer h.finishImport(1)
+		reports <- h.importLinks(ctx, 1, links, nil)
+	}()
+	<-srv.started
+
+	deleted := make(chan struct{})
+	go func() {
+		h.DeleteMeInline(&tb.Callback{
+			ID:      "1",
+			Sender:  &tb.User{ID: 1},
+			Message: &tb.Message{ID: 1, Chat: &tb.Chat{ID: 1}},
+			Data:    deleteMeConfirm,
+		})
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatal("user is not deleted")
+	}
+
+	if srv.deletedWhileSubscribing {
+		t.Fatal("user is deleted while import is in progress")
+	}
+	// import is finished before user is deleted
+	select {
+	case report := <-reports:
+		if !reflect.DeepEqual(report.failed, links) {
+			t.Fatalf("unexpected failed links: %v", report.failed)
+		}
+	default:
+		t.Fatal("user is deleted before import is finished")
+	}
+
+	// import of another user is not affected
+	_, err = h.startImport(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.finishImport(2)
+}
+
+// subscribingService records subscribed links.
+// Other methods of service.Service must not be called.
+type subscribingService struct {
+	service.Service
+
+	mu    sync.Mutex
+	links []string
+}
+
+func (s *subscribingService) Subscribe(_ context.Context, _ int, link string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.links = append(s.links, link)
+	return nil
+}
+
+func TestImportCaption(t *testing.T) {
+	const link = "https://testflight.apple.com/join/AAAAAAAA"
+	tests := []struct {
+		name    string
+		caption string
+		links   []string
+		reply   string
+	}{
+		{
+			name:    "links",
+			caption: "Join the beta: testflight.apple.com/join/AAAAAAAA",
+			links:   []string{link},
+			reply:   "You have been subscribed",
+		},
+		{
+			name:    "no links",
+			caption: "Release notes",
+			reply:   importFormatText,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, sent := newSendBot(t)
+			srv := &subscribingService{}
+			h := newHandler(b, srv, "")
+
+			// large file of unsupported format is not downloaded
+			h.Import(&tb.Message{
+				Sender: &tb.User{ID: 1},
+				Document: &tb.Document{
+					File:     tb.File{FileSize: 10 * maxImportSize},
+					FileName: "notes.pdf",
+					MIME:     "application/pdf",
+				},
+				Caption: tt.caption,
+			})
+
+			if !reflect.DeepEqual(srv.links, tt.links) {
+				t.Fatalf("unexpected subscribed links: %v", srv.links)
+			}
+			texts := sent()
+			if len(texts) != 1 || !strings.Contains(texts[0], tt.reply) {
+				t.Fatalf("unexpected sent messages: %q", texts)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// listPageSize is count of subscriptions on one page of /list.
+	listPageSize = 5
+	// listPageUnique is unique of buttons that switch pages of /list.
+	listPageUnique = "list"
+)
+
+const listTimeLayout = "2006-01-02 15:04 MST"
+
+// listItem is subscription shown by /list.
+type listItem struct {
+	sub   service.Subscription
+	check service.BetaCheck // zero if beta has not been checked yet
+}
+
+// List sends the first page of user subscriptions.
+func (h *handler) List(m *tb.Message) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "list"))
+
+	text, keyboard, err := h.listPage(int(m.Sender.ID), 0)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get subscriptions")
+		text, keyboard = internalErrorText, new(tb.ReplyMarkup)
+	}
+
+	_, err = h.bot.Send(m.Sender, text, keyboard, tb.NoPreview, tb.ModeMarkdown)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to send message")
+		return
+	}
+}
+
+// ListPage switches page of /list message.
+func (h *handler) ListPage(c *tb.Callback) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "list_page"))
+
+	resp := &tb.CallbackResponse{
+		CallbackID: c.ID,
+		ShowAlert:  true,
+		Text:       "Something went wrong",
+	}
+	defer func(bot *tb.Bot, c *tb.Callback, resp *tb.CallbackResponse) {
+		err := bot.Respond(c, resp)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to respond")
+		}
+	}(h.bot, c, resp)
+
+	page, err := strconv.Atoi(c.Data)
+	if err != nil || page < 0 {
+		logger.With(zap.String("data", c.Data)).Warn("invalid page")
+		return
+	}
+
+	text, keyboard, err := h.listPage(int(c.Sender.ID), page)
+	if err != nil {
+		return
+	}
+
+	err = h.edit(c.Message, text, keyboard)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to edit message")
+		return
+	}
+
+	resp.Text = ""
+	resp.ShowAlert = false
+}
+
+// listPage returns text and keyboard of the page of user subscriptions.
+// Page is clamped, so the last page is returned if subscriptions are removed.
+func (h *handler) listPage(userID, page int) (string, *tb.ReplyMarkup, error) {
+	subs, err := h.srv.GetUserSubscriptions(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	sortSubscriptions(subs)
+
+	start, end, page, pages := paginate(len(subs), page, listPageSize)
+
+	items := make([]listItem, 0, end-start)
+	for _, sub := range subs[start:end] {
+		check, err := h.srv.GetLastBetaCheck(sub.Link)
+		if err != nil && !errors.Is(err, service.ErrBetaCheckNotFound) {
+			return "", nil, err
+		}
+		items = append(items, listItem{sub: sub, check: check})
+	}
+
+	return formatList(items, len(subs), start, page, pages), listKeyboard(page, pages), nil
+}
+
+// formatList returns markdown text of the page of subscriptions.
+// Start is index of the first item among total subscriptions.
+func formatList(items []listItem, total, start, page, pages int) string {
+	if total == 0 {
+		return "You have no subscriptions yet.\nSend /subscribe " + linkExample
+	}
+
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "📋 Your subscriptions: %d", total)
+	if pages > 1 {
+		_, _ = fmt.Fprintf(&sb, " (page %d of %d)", page+1, pages)
+	}
+
+	for i, item := range items {
+		sub := item.sub
+
+		_, _ = fmt.Fprintf(&sb, "\n\n*%d. %s*", start+i+1, escapeMarkdown(sub.AppName))
+		if details := betaDetails(sub.Metadata.Developer, sub.Metadata.Platforms); details != "" {
+			sb.WriteString("\n" + escapeMarkdown(details))
+		}
+		sb.WriteString("\n" + escapeMarkdown(sub.Link))
+		sb.WriteString("\n" + statusLabel(beta.ParseStatus(sub.LastStatus)))
+		if sub.Inactive {
+			sb.WriteString(" · ⏸ paused, send /start to resume")
+		}
+
+		switch {
+		case item.check.CheckedAt.IsZero():
+			sb.WriteString("\nNot checked yet")
+		case item.check.Error != "":
+			sb.WriteString("\nLast check failed at " + item.check.CheckedAt.UTC().Format(listTimeLayout))
+		default:
+			sb.WriteString("\nChecked at " + item.check.CheckedAt.UTC().Format(listTimeLayout))
+		}
+		if !sub.CreatedAt.IsZero() {
+			sb.WriteString("\nSubscribed at " + sub.CreatedAt.UTC().Format(listTimeLayout))
+		}
+	}
+
+	return sb.String()
+}
+
+// listKeyboard returns buttons that switch pages of /list.
+// It has no buttons if there is only one page.
+func listKeyboard(page, pages int) *tb.ReplyMarkup {
+	selector := new(tb.ReplyMarkup)
+	if pages <= 1 {
+		return selector
+	}
+
+	selector.Inline(pageRow(selector, listPageUnique, page, pages, strconv.Itoa))
+	return selector
+}
+
+// sortSubscriptions sorts subscriptions by app name,
+// so pages are stable while subscriptions are not changed.
+func sortSubscriptions(subs []service.Subscription) {
+	sort.Slice(subs, func(i, j int) bool {
+		a, b := strings.ToLower(subs[i].AppName), strings.ToLower(subs[j].AppName)
+		if a != b {
+			return a < b
+		}
+		return subs[i].ID < subs[j].ID
+	})
+}
+
+// statusLabel returns human-readable status of the beta.
+func statusLabel(status beta.Status) string {
+	switch status {
+	case beta.StatusOpen:
+		return "🟢 Open"
+	case beta.StatusFull:
+		return "🟡 Full"
+	case beta.StatusNotAccepting:
+		return "🔴 Not accepting testers"
+	case beta.StatusNotFound:
+		return "⚫️ Not found"
+	default:
+		return "⚪️ Unknown"
+	}
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// failingService fails to get subscriptions.
+// Other methods of service.Service must not be called.
+type failingService struct {
+	service.Service
+}
+
+func (failingService) GetUserSubscriptions(int) ([]service.Subscription, error) {
+	return nil, errors.New("database is locked")
+}
+
+// newSendBot returns bot that collects texts of sent messages.
+func newSendBot(t *testing.T) (*tb.Bot, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		texts []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Text string `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+
+		mu.Lock()
+		texts = append(texts, params.Text)
+		mu.Unlock()
+
+		_, _ = fmt.Fprint(w, okResponse)
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := tb.NewBot(tb.Settings{
+		URL:     server.URL,
+		Token:   "token",
+		Offline: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), texts...)
+	}
+}
+
+func TestFormatList(t *testing.T) {
+	checkedAt := time.Date(2022, 1, 2, 15, 4, 0, 0, time.UTC)
+	items := []listItem{
+		{
+			sub: service.Subscription{Subscription: repository.Subscription{
+				Link:       "https://testflight.apple.com/join/a",
+				AppName:    "My_App",
+				LastStatus: "open",
+				CreatedAt:  time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC),
+			}},
+			check: service.BetaCheck{BetaCheck: repository.BetaCheck{CheckedAt: checkedAt}},
+		},
+		{
+			sub: service.Subscription{Subscription: repository.Subscription{
+				Link:    "https://testflight.apple.com/join/b",
+				AppName: "Other",
+			}},
+		},
+	}
+
+	text := formatList(items, 7, 5, 1, 2)
+	for _, want := range []string{
+		"Your subscriptions: 7 (page 2 of 2)",
+		"*6. My\\_App*",
+		"https://testflight.apple.com/join/a",
+		"🟢 Open",
+		"Checked at 2022-01-02 15:04 UTC",
+		"Subscribed at 2022-01-01 12:30 UTC",
+		"*7. Other*",
+		"Not checked yet",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "Subscribed at") != 1 {
+		t.Errorf("unknown subscription time is shown:\n%s", text)
+	}
+}
+
+func TestListKeyboard(t *testing.T) {
+	tests := []struct {
+		page, pages int
+		want        []string
+	}{
+		{0, 1, nil},
+		{0, 3, []string{"1"}},
+		{1, 3, []string{"0", "2"}},
+		{2, 3, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		keyboard := listKeyboard(tt.page, tt.pages)
+
+		var got []string
+		for _, row := range keyboard.InlineKeyboard {
+			for _, btn := range row {
+				got = append(got, btn.Data)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("listKeyboard(%d, %d) switches to pages %v, want %v", tt.page, tt.pages, got, tt.want)
+		}
+	}
+}
+
+func TestListServiceError(t *testing.T) {
+	b, sent := newSendBot(t)
+	h := newHandler(b, failingService{}, "")
+
+	h.List(&tb.Message{Sender: &tb.User{ID: 1}})
+
+	texts := sent()
+	if len(texts) != 1 || texts[0] != internalErrorText {
+		t.Fatalf("unexpected sent messages: %q", texts)
+	}
+}
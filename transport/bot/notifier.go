@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type notifier struct {
+	queue *DeliveryQueue
+}
+
+// NewNotifier returns notifier that sends
+// beta status changes to subscribers via Telegram.
+// Messages are sent through the delivery queue.
+func NewNotifier(q *DeliveryQueue) service.Notifier {
+	return &notifier{queue: q}
+}
+
+func (n *notifier) Notify(ctx context.Context, event service.Event) error {
+	sub := event.Subscription
+	logger := zap.L().
+		Named("notifier").
+		With(zap.Stringer("event", event.Type)).
+		With(zap.Int("user_id", sub.UserID)).
+		With(zap.String("link", sub.Link)).
+		With(zap.Stringer("status", event.Status))
+
+	if event.Type == service.EventCheckFailed {
+		logger.With(zap.Error(event.Err)).Debug("check failure is not sent to users")
+		return nil
+	}
+
+	text, ok := statusText(sub, event.Status)
+	if !ok {
+		logger.Error("unexpected status")
+		return nil
+	}
+
+	_, err := n.queue.Send(
+		ctx,
+		&tb.User{ID: int64(sub.UserID)},
+		text,
+		tb.NoPreview,
+		tb.ModeMarkdown,
+	)
+	if err != nil {
+		if reason, ok := unreachableReason(err); ok {
+			return fmt.Errorf("%w: %s", service.ErrUserUnreachable, reason)
+		}
+		return err
+	}
+
+	logger.Debug("notification is sent")
+	return nil
+}
+
+// unreachableReason classifies error of message delivery.
+// It returns reason if user can not receive messages from the bot anymore.
+func unreachableReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, tb.ErrBlockedByUser):
+		return "user has blocked the bot", true
+	case errors.Is(err, tb.ErrUserIsDeactivated):
+		return "user is deactivated", true
+	case errors.Is(err, tb.ErrChatNotFound):
+		return "chat is not found", true
+	case errors.Is(err, tb.ErrNotStartedByUser):
+		return "user has not started the bot", true
+	default:
+		return "", false
+	}
+}
+
+// statusText returns text of notification about new status of the beta.
+func statusText(sub service.Subscription, status beta.Status) (string, bool) {
+	name := "[" + escapeMarkdown(sub.AppName) + "](" + sub.Link + ")"
+	var text string
+	switch status {
+	case beta.StatusOpen:
+		text = "✅ " + name + " beta has free slots!"
+	case beta.StatusFull:
+		text = "⛔️ " + name + " beta is full again."
+	case beta.StatusNotAccepting:
+		text = "⛔️ " + name + " beta isn't accepting new testers anymore."
+	case beta.StatusNotFound:
+		text = "❌ " + name + " beta is not found anymore."
+	default:
+		return "", false
+	}
+
+	md := sub.Metadata
+	if details := betaDetails(md.Developer, md.Platforms); details != "" {
+		text += "\n" + escapeMarkdown(details)
+	}
+	if md.Description != "" {
+		text += "\n\n" + escapeMarkdown(truncate(md.Description, maxDescriptionLen))
+	}
+
+	return text, true
+}
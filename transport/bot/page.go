@@ -0,0 +1,39 @@
+package bot
+
+import tb "gopkg.in/tucnak/telebot.v2"
+
+// paginate returns bounds of the page of n items split into pages of size.
+// Page is clamped to existing pages, so the last page is returned
+// if items have been removed since the page was shown.
+func paginate(n, page, size int) (start, end, clamped, pages int) {
+	pages = (n + size - 1) / size
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	start = page * size
+	end = start + size
+	if end > n {
+		end = n
+	}
+
+	return start, end, page, pages
+}
+
+// pageRow returns buttons that switch to the previous and the next pages.
+// Data returns callback data of button that switches to the page.
+// Row is empty if there is only one page.
+func pageRow(selector *tb.ReplyMarkup, unique string, page, pages int, data func(page int) string) tb.Row {
+	var row tb.Row
+	if page > 0 {
+		row = append(row, selector.Data("« Prev", unique, data(page-1)))
+	}
+	if page < pages-1 {
+		row = append(row, selector.Data("Next »", unique, data(page+1)))
+	}
+
+	return row
+}
@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// ErrQueueClosed is error that will be returned
+// if message is sent to closed delivery queue.
+var ErrQueueClosed = errors.New("delivery queue is closed")
+
+// chatLimitersPruneInterval is interval between removals
+// of per-chat limiters that have not been used for a while.
+const chatLimitersPruneInterval = time.Minute
+
+// DeliveryConfig is configuration of delivery queue.
+type DeliveryConfig struct {
+	// Rate is maximum count of messages per second sent by the bot.
+	// Zero value means no limit.
+	Rate  float64
+	Burst int
+	// ChatInterval is minimum interval between messages to one chat.
+	ChatInterval time.Duration
+	// Workers is count of messages that are sent concurrently.
+	Workers int
+	// MaxAttempts is maximum count of attempts to send a message.
+	MaxAttempts int
+	// Backoff is delay before the first retry.
+	// It doubles with every next retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DeliveryQueue sends messages with global and per-chat rate limits.
+// Failed messages are retried with backoff,
+// retry_after of Telegram is honored by all workers.
+type DeliveryQueue struct {
+	bot *tb.Bot
+	cfg DeliveryConfig
+
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	chats       map[string]*chatLimiter // limiters by recipient
+	pausedUntil time.Time               // time until Telegram asked to stop sending
+
+	queue chan *delivery
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+type chatLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// delivery is a message waiting in the queue.
+type delivery struct {
+	ctx        context.Context
+	to         tb.Recipient
+	what       interface{}
+	opts       []interface{}
+	enqueuedAt time.Time
+
+	res chan deliveryResult
+}
+
+type deliveryResult struct {
+	msg *tb.Message
+	err error
+}
+
+// NewDeliveryQueue returns new delivery queue and starts its workers.
+func NewDeliveryQueue(b *tb.Bot, cfg DeliveryConfig) *DeliveryQueue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+
+	limit := rate.Inf
+	if cfg.Rate > 0 {
+		limit = rate.Limit(cfg.Rate)
+	}
+
+	q := &DeliveryQueue{
+		bot:     b,
+		cfg:     cfg,
+		limiter: rate.NewLimiter(limit, cfg.Burst),
+		chats:   make(map[string]*chatLimiter),
+		queue:   make(chan *delivery),
+		done:    make(chan struct{}),
+		logger:  zap.L().Named("delivery_queue"),
+	}
+
+	q.wg.Add(cfg.Workers + 1)
+	for i := 0; i < cfg.Workers; i++ {
+		go q.work()
+	}
+	go q.pruneChats()
+
+	return q
+}
+
+// Send sends message like tb.Bot.Send does
+// and waits until message is delivered or delivery is failed.
+func (q *DeliveryQueue) Send(ctx context.Context, to tb.Recipient, what interface{}, opts ...interface{}) (*tb.Message, error) {
+	d := &delivery{
+		ctx:        ctx,
+		to:         to,
+		what:       what,
+		opts:       opts,
+		enqueuedAt: time.Now(),
+		res:        make(chan deliveryResult, 1),
+	}
+
+	select {
+	case q.queue <- d:
+	case <-q.done:
+		return nil, ErrQueueClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-d.res:
+		return res.msg, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops workers of the queue.
+// Messages that are being sent are canceled.
+func (q *DeliveryQueue) Close() error {
+	close(q.done)
+	q.wg.Wait()
+	return nil
+}
+
+func (q *DeliveryQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case d := <-q.queue:
+			msg, err := q.deliver(d)
+			d.res <- deliveryResult{msg: msg, err: err}
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// deliver sends message making retries if needed.
+func (q *DeliveryQueue) deliver(d *delivery) (*tb.Message, error) {
+	logger := q.logger.With(zap.String("recipient", d.to.Recipient()))
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-q.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := q.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := q.wait(ctx, d.to)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := q.bot.Send(d.to, d.what, d.opts...)
+		if err == nil {
+			logger.
+				With(zap.Int("attempts", attempt)).
+				With(zap.Duration("latency", time.Since(d.enqueuedAt))).
+				Debug("message is delivered")
+			return msg, nil
+		}
+
+		delay, ok := q.retryDelay(err, backoff)
+		if !ok || attempt >= q.cfg.MaxAttempts {
+			logger.
+				With(zap.Error(err)).
+				With(zap.Int("attempts", attempt)).
+				With(zap.Duration("latency", time.Since(d.enqueuedAt))).
+				Debug("message is not delivered")
+			return nil, err
+		}
+
+		logger.
+			With(zap.Error(err)).
+			With(zap.Int("attempt", attempt)).
+			With(zap.Duration("delay", delay)).
+			Warn("failed to send message, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		backoff *= 2
+		if q.cfg.MaxBackoff > 0 && backoff > q.cfg.MaxBackoff {
+			backoff = q.cfg.MaxBackoff
+		}
+	}
+}
+
+// wait waits until message can be sent to the recipient.
+func (q *DeliveryQueue) wait(ctx context.Context, to tb.Recipient) error {
+	q.mu.Lock()
+	pause := time.Until(q.pausedUntil)
+	q.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	err := q.chatLimiter(to).Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	return q.limiter.Wait(ctx)
+}
+
+// retryDelay returns delay before the next attempt to send message.
+// It returns false if message should not be sent again.
+func (q *DeliveryQueue) retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var floodErr tb.FloodError
+	if errors.As(err, &floodErr) {
+		delay := time.Duration(floodErr.RetryAfter) * time.Second
+
+		// Telegram limits the whole bot, so all workers are paused
+		q.mu.Lock()
+		if pausedUntil := time.Now().Add(delay); pausedUntil.After(q.pausedUntil) {
+			q.pausedUntil = pausedUntil
+		}
+		q.mu.Unlock()
+
+		return delay, true
+	}
+
+	var apiErr *tb.APIError
+	if errors.As(err, &apiErr) {
+		isRetryable := apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+		return backoff, isRetryable
+	}
+
+	// network errors and errors unknown to telebot
+	return backoff, true
+}
+
+func (q *DeliveryQueue) chatLimiter(to tb.Recipient) *rate.Limiter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	chat, ok := q.chats[to.Recipient()]
+	if !ok {
+		limit := rate.Inf
+		if q.cfg.ChatInterval > 0 {
+			limit = rate.Every(q.cfg.ChatInterval)
+		}
+
+		chat = &chatLimiter{limiter: rate.NewLimiter(limit, 1)}
+		q.chats[to.Recipient()] = chat
+	}
+	chat.lastUsed = time.Now()
+
+	return chat.limiter
+}
+
+// pruneChats periodically removes limiters of chats
+// that have not received messages for a while.
+func (q *DeliveryQueue) pruneChats() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(chatLimitersPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			for recipient, chat := range q.chats {
+				if time.Since(chat.lastUsed) > chatLimitersPruneInterval+q.cfg.ChatInterval {
+					delete(q.chats, recipient)
+				}
+			}
+			q.mu.Unlock()
+		case <-q.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// newTestBot returns bot that sends requests to Telegram API
+// served by handler. Handler receives number of request.
+func newTestBot(t *testing.T, handler func(w http.ResponseWriter, n int)) *tb.Bot {
+	t.Helper()
+
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n++
+		i := n
+		mu.Unlock()
+
+		handler(w, i)
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := tb.NewBot(tb.Settings{
+		URL:     server.URL,
+		Token:   "token",
+		Offline: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+const okResponse = `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`
+
+func newTestQueue(t *testing.T, b *tb.Bot, cfg DeliveryConfig) *DeliveryQueue {
+	t.Helper()
+
+	q := NewDeliveryQueue(b, cfg)
+	t.Cleanup(func() {
+		_ = q.Close()
+	})
+
+	return q
+}
+
+func TestDeliveryQueueRetryAfter(t *testing.T) {
+	b := newTestBot(t, func(w http.ResponseWriter, n int) {
+		if n == 1 {
+			_, _ = fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, okResponse)
+	})
+	q := newTestQueue(t, b, DeliveryConfig{MaxAttempts: 2, Backoff: time.Millisecond})
+
+	start := time.Now()
+	_, err := q.Send(context.Background(), &tb.User{ID: 1}, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retry_after is not honored, message is sent in %s", elapsed)
+	}
+}
+
+func TestDeliveryQueueBackoff(t *testing.T) {
+	b := newTestBot(t, func(w http.ResponseWriter, n int) {
+		if n < 3 {
+			_, _ = fmt.Fprint(w, `{"ok":false,"error_code":500,"description":"Internal Server Error"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, okResponse)
+	})
+
+	q := newTestQueue(t, b, DeliveryConfig{MaxAttempts: 2, Backoff: time.Millisecond})
+	_, err := q.Send(context.Background(), &tb.User{ID: 1}, "text")
+	if err == nil {
+		t.Fatal("expected error after last attempt")
+	}
+
+	_, err = q.Send(context.Background(), &tb.User{ID: 1}, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliveryQueuePermanentError(t *testing.T) {
+	var attempts int
+	b := newTestBot(t, func(w http.ResponseWriter, n int) {
+		attempts = n
+		_, _ = fmt.Fprint(w, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`)
+	})
+	q := newTestQueue(t, b, DeliveryConfig{MaxAttempts: 5, Backoff: time.Millisecond})
+
+	_, err := q.Send(context.Background(), &tb.User{ID: 1}, "text")
+	if !errors.Is(err, tb.ErrBlockedByUser) {
+		t.Fatalf("expected ErrBlockedByUser, got %v", err)
+	}
+	if reason, ok := unreachableReason(err); !ok || reason == "" {
+		t.Fatal("blocked user is not classified as unreachable")
+	}
+	if attempts != 1 {
+		t.Fatalf("permanent error is retried, attempts: %d", attempts)
+	}
+}
+
+func TestDeliveryQueueChatInterval(t *testing.T) {
+	b := newTestBot(t, func(w http.ResponseWriter, n int) {
+		_, _ = fmt.Fprint(w, okResponse)
+	})
+	q := newTestQueue(t, b, DeliveryConfig{
+		Workers:      2,
+		ChatInterval: 200 * time.Millisecond,
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := q.Send(context.Background(), &tb.User{ID: 1}, "text")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("chat interval is not honored, messages are sent in %s", elapsed)
+	}
+
+	// other chats are not limited by the chat
+	start = time.Now()
+	_, err := q.Send(context.Background(), &tb.User{ID: 2}, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("another chat is limited, message is sent in %s", elapsed)
+	}
+}
@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// maxLinksPerMessage is maximum count of links
+// that are subscribed from one message.
+const maxLinksPerMessage = 20
+
+// subscribeResult is result of subscribing one link.
+type subscribeResult struct {
+	link    string
+	appName string // empty if app name is unknown
+	err     error
+}
+
+// Subscribe subscribes the user to every beta of /subscribe command.
+// Links may be passed in any form that beta.ParseLink accepts.
+func (h *handler) Subscribe(m *tb.Message) {
+	links := messageLinks(m)
+	for _, field := range strings.Fields(m.Payload) {
+		link, err := beta.ParseLink(field)
+		if err == nil {
+			links = appendLink(links, link)
+		}
+	}
+
+	if len(links) == 0 {
+		h.reply(m, subscribeErrorText(m.Payload, beta.ErrInvalidTestFlightLink))
+		return
+	}
+
+	h.subscribeLinks(m, links)
+}
+
+// SubscribeLinks subscribes the user to every beta link
+// found in text or caption of any message, e.g. forwarded post.
+// Messages without links are ignored.
+func (h *handler) SubscribeLinks(m *tb.Message) {
+	links := messageLinks(m)
+	if len(links) == 0 {
+		return
+	}
+
+	h.subscribeLinks(m, links)
+}
+
+// subscribeLinks subscribes the user to the links
+// and replies with result of every link.
+func (h *handler) subscribeLinks(m *tb.Message, links []string) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "subscribe")).
+		With(zap.Int("links", len(links)))
+
+	userID := int(m.Sender.ID)
+	if len(links) == 1 {
+		err := h.srv.Subscribe(h.ctx, userID, links[0])
+		if err != nil {
+			logger.With(zap.Error(err)).Debug("failed to subscribe")
+			h.reply(m, subscribeErrorText(links[0], err))
+			return
+		}
+
+		h.reply(m, "⚡️ You have been subscribed the beta")
+		return
+	}
+
+	var skipped int
+	if len(links) > maxLinksPerMessage {
+		skipped = len(links) - maxLinksPerMessage
+		links = links[:maxLinksPerMessage]
+	}
+
+	err := h.bot.Notify(m.Sender, tb.Typing)
+	if err != nil {
+		logger.With(zap.Error(err)).Warn("failed to send chat action")
+	}
+
+	results := make([]subscribeResult, len(links))
+	for i, link := range links {
+		results[i] = subscribeResult{
+			link: link,
+			err:  h.srv.Subscribe(h.ctx, userID, link),
+		}
+	}
+
+	// app names are known only after betas are requested
+	subs, err := h.srv.GetUserSubscriptions(userID)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get user subscriptions")
+	}
+	for i := range results {
+		for _, sub := range subs {
+			if sub.Link == results[i].link {
+				results[i].appName = sub.AppName
+				break
+			}
+		}
+	}
+
+	h.reply(m, formatSubscribeResults(results, skipped))
+}
+
+// reply sends markdown text to sender of the message.
+func (h *handler) reply(m *tb.Message, text string) {
+	_, err := h.bot.Send(m.Sender, text, tb.NoPreview, tb.ModeMarkdown)
+	if err != nil {
+		zap.L().
+			Named("handler").
+			With(zap.Error(err)).
+			Error("failed to send message")
+	}
+}
+
+// messageLinks returns TestFlight links found in text or caption of the message
+// including links hidden behind text.
+func messageLinks(m *tb.Message) []string {
+	texts := []string{m.Text, m.Caption}
+	for _, entities := range [][]tb.MessageEntity{m.Entities, m.CaptionEntities} {
+		for _, entity := range entities {
+			if entity.Type == tb.EntityTextLink {
+				texts = append(texts, entity.URL)
+			}
+		}
+	}
+
+	var links []string
+	for _, text := range texts {
+		for _, link := range beta.FindLinks(text) {
+			links = appendLink(links, link)
+		}
+	}
+
+	return links
+}
+
+// appendLink appends link if links do not contain it yet.
+func appendLink(links []string, link string) []string {
+	for _, l := range links {
+		if l == link {
+			return links
+		}
+	}
+
+	return append(links, link)
+}
+
+// formatSubscribeResults returns markdown summary of subscribing links.
+// Skipped is count of links that are not subscribed because of the limit.
+func formatSubscribeResults(results []subscribeResult, skipped int) string {
+	var subscribed int
+	for _, res := range results {
+		if res.err == nil {
+			subscribed++
+		}
+	}
+
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "⚡️ Subscribed %d of %d betas:\n", subscribed, len(results))
+	for _, res := range results {
+		name := escapeMarkdown(res.link)
+		if res.appName != "" {
+			name = "*" + escapeMarkdown(res.appName) + "* " + name
+		}
+
+		switch {
+		case res.err == nil:
+			sb.WriteString("\n✅ " + name)
+		case errors.Is(res.err, service.ErrAlreadySubscribed):
+			sb.WriteString("\n☑️ " + name + " — already subscribed")
+		default:
+			sb.WriteString("\n❌ " + name + " — " + subscribeFailure(res.err))
+		}
+	}
+
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(&sb, "\n\n%d more links are skipped, up to %d links are subscribed at once. "+
+			"Send the rest in another message.", skipped, maxLinksPerMessage)
+	}
+
+	return sb.String()
+}
+
+// subscribeFailure returns short reason of failed subscription.
+func subscribeFailure(err error) string {
+	switch {
+	case errors.Is(err, beta.ErrInvalidTestFlightLink):
+		return "beta does not exist"
+	case errors.Is(err, beta.ErrStatusNotOK):
+		return "TestFlight is not available"
+	case errors.Is(err, beta.ErrUnexpected), errors.Is(err, context.DeadlineExceeded):
+		return "failed to reach TestFlight"
+	default:
+		return "something went wrong on our side"
+	}
+}
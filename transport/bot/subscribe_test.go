@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestMessageLinks(t *testing.T) {
+	m := &tb.Message{
+		Text: "New betas:\n" +
+			"1. https://testflight.apple.com/join/AAAAAAAA\n" +
+			"2. testflight.apple.com/join/BBBBBBBB/\n" +
+			"3. itms-beta://TestFlight.apple.com/join/CCCCCCCC?x=1\n" +
+			"4. https://testflight.apple.com/join/AAAAAAAA again\n" +
+			"5. https://testflight.apple.com/join/TOOLONGCODE\n" +
+			"6. Join here",
+		Entities: []tb.MessageEntity{
+			{Type: tb.EntityTextLink, URL: "https://testflight.apple.com/join/DDDDDDDD"},
+			{Type: tb.EntityTextLink, URL: "https://example.com"},
+		},
+		Caption: "https://testflight.apple.com/join/EEEEEEEE",
+	}
+
+	expected := []string{
+		"https://testflight.apple.com/join/AAAAAAAA",
+		"https://testflight.apple.com/join/BBBBBBBB",
+		"https://testflight.apple.com/join/CCCCCCCC",
+		"https://testflight.apple.com/join/EEEEEEEE",
+		"https://testflight.apple.com/join/DDDDDDDD",
+	}
+	if links := messageLinks(m); !reflect.DeepEqual(links, expected) {
+		t.Fatalf("unexpected links: %v", links)
+	}
+
+	if links := messageLinks(&tb.Message{Text: "just text ABCDEFGH"}); len(links) != 0 {
+		t.Fatalf("unexpected links: %v", links)
+	}
+}
+
+func TestFormatSubscribeResults(t *testing.T) {
+	text := formatSubscribeResults([]subscribeResult{
+		{link: "https://testflight.apple.com/join/AAAAAAAA", appName: "App_A"},
+		{link: "https://testflight.apple.com/join/BBBBBBBB", appName: "B", err: service.ErrAlreadySubscribed},
+		{link: "https://testflight.apple.com/join/CCCCCCCC", err: beta.ErrInvalidTestFlightLink},
+		{link: "https://testflight.apple.com/join/DDDDDDDD", err: errors.New("database is locked")},
+	}, 3)
+
+	for _, want := range []string{
+		"Subscribed 1 of 4 betas",
+		"✅ *App\\_A* https://testflight.apple.com/join/AAAAAAAA",
+		"☑️ *B* https://testflight.apple.com/join/BBBBBBBB — already subscribed",
+		"❌ https://testflight.apple.com/join/CCCCCCCC — beta does not exist",
+		"❌ https://testflight.apple.com/join/DDDDDDDD — something went wrong on our side",
+		"3 more links are skipped",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+}
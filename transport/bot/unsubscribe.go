@@ -0,0 +1,360 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mcldresner/tfdog/beta"
+	"git.sr.ht/~mcldresner/tfdog/repository"
+	"git.sr.ht/~mcldresner/tfdog/service"
+	"go.uber.org/zap"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// unsubscribePageSize is count of subscriptions on one page of /unsubscribe.
+	unsubscribePageSize = 8
+	// unsubscribeUnique is unique of buttons of /unsubscribe.
+	unsubscribeUnique = "unsub"
+	// unsubscribeVersion is version of callback data of /unsubscribe buttons.
+	// It must be changed along with the data format,
+	// so buttons of old messages are rejected.
+	unsubscribeVersion = "2"
+)
+
+// Actions of /unsubscribe buttons.
+const (
+	actionPage    = "p" // show page
+	actionConfirm = "c" // ask to confirm removal of subscription
+	actionRemove  = "r" // remove subscription
+	actionUndo    = "u" // subscribe removed beta again
+)
+
+// errInvalidCallbackData is returned if callback data can not be parsed.
+var errInvalidCallbackData = errors.New("invalid callback data")
+
+// unsubscribeData is callback data of /unsubscribe buttons.
+// It is encoded like "version|action|page|target",
+// target of undo is encoded like "code|status|created".
+type unsubscribeData struct {
+	action string
+	// page is page of subscriptions to return to.
+	page int
+	// id is ID of subscription to confirm or remove.
+	id int64
+	// code is code of beta link to subscribe on undo.
+	code string
+	// status is last status of removed subscription restored on undo.
+	// It is empty if beta has not been checked yet.
+	status string
+	// created is Unix time when removed subscription was created.
+	// It is zero if the time is unknown.
+	created int64
+}
+
+// String encodes callback data.
+func (d unsubscribeData) String() string {
+	parts := []string{unsubscribeVersion, d.action, strconv.Itoa(d.page)}
+	switch d.action {
+	case actionConfirm, actionRemove:
+		parts = append(parts, strconv.FormatInt(d.id, 10))
+	case actionUndo:
+		parts = append(parts, d.code, d.status, strconv.FormatInt(d.created, 10))
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// subscription returns removed subscription of the user that is restored on undo.
+func (d unsubscribeData) subscription(userID int) service.Subscription {
+	sub := repository.Subscription{
+		UserID:     userID,
+		Link:       d.code,
+		LastStatus: d.status,
+	}
+	if d.created > 0 {
+		sub.CreatedAt = time.Unix(d.created, 0)
+	}
+
+	return service.Subscription{Subscription: sub}
+}
+
+// parseUnsubscribeData parses and validates callback data.
+// errInvalidCallbackData is returned if data is malformed
+// or is encoded by another version.
+func parseUnsubscribeData(s string) (unsubscribeData, error) {
+	parts := strings.Split(s, "|")
+	if len(parts) < 3 || parts[0] != unsubscribeVersion {
+		return unsubscribeData{}, errInvalidCallbackData
+	}
+
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 0 {
+		return unsubscribeData{}, errInvalidCallbackData
+	}
+
+	d := unsubscribeData{action: parts[1], page: page}
+	switch d.action {
+	case actionPage:
+		if len(parts) != 3 {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+	case actionConfirm, actionRemove:
+		if len(parts) != 4 {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+		d.id, err = strconv.ParseInt(parts[3], 10, 64)
+		if err != nil || d.id <= 0 {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+	case actionUndo:
+		if len(parts) != 6 {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+		// only bare code is accepted, not any form of link
+		code, err := beta.LinkCode(parts[3])
+		if err != nil || code != parts[3] {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+		d.code = code
+
+		d.status = parts[4]
+		if d.status != "" && beta.ParseStatus(d.status).String() != d.status {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+		d.created, err = strconv.ParseInt(parts[5], 10, 64)
+		if err != nil || d.created < 0 {
+			return unsubscribeData{}, errInvalidCallbackData
+		}
+	default:
+		return unsubscribeData{}, errInvalidCallbackData
+	}
+
+	return d, nil
+}
+
+// Unsubscribe sends the first page of subscriptions to choose one to remove.
+func (h *handler) Unsubscribe(m *tb.Message) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "unsubscribe"))
+
+	text, keyboard, err := h.unsubscribePage(int(m.Sender.ID), 0)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to get subscriptions")
+		text, keyboard = internalErrorText, new(tb.ReplyMarkup)
+	}
+
+	_, err = h.bot.Send(m.Sender, text, keyboard, tb.NoPreview, tb.ModeMarkdown)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to send message")
+		return
+	}
+}
+
+// UnsubscribeInline handles buttons of /unsubscribe message.
+func (h *handler) UnsubscribeInline(c *tb.Callback) {
+	logger := zap.L().
+		Named("handler").
+		With(zap.String("command", "unsubscribe_inline"))
+
+	resp := &tb.CallbackResponse{
+		CallbackID: c.ID,
+		ShowAlert:  true,
+		Text:       "Something went wrong",
+	}
+	defer func(bot *tb.Bot, c *tb.Callback, resp *tb.CallbackResponse) {
+		err := bot.Respond(c, resp)
+		if err != nil {
+			logger.With(zap.Error(err)).Error("failed to respond")
+		}
+	}(h.bot, c, resp)
+
+	data, err := parseUnsubscribeData(c.Data)
+	if err != nil {
+		logger.With(zap.String("data", c.Data)).Warn("invalid callback data")
+		resp.Text = "This message is outdated, send /unsubscribe again."
+		return
+	}
+
+	userID := int(c.Sender.ID)
+	var (
+		text     string
+		keyboard *tb.ReplyMarkup
+		notice   string // notice is shown to user if message is edited
+	)
+	switch data.action {
+	case actionPage:
+		text, keyboard, err = h.unsubscribePage(userID, data.page)
+	case actionConfirm:
+		text, keyboard, err = h.unsubscribeConfirmation(userID, data)
+	case actionRemove:
+		text, keyboard, err = h.unsubscribeRemove(userID, data)
+		notice = "Successfully unsubscribed"
+	case actionUndo:
+		err = h.srv.Resubscribe(h.ctx, data.subscription(userID))
+		if err != nil && !errors.Is(err, service.ErrAlreadySubscribed) {
+			resp.Text = subscribeErrorText(data.code, err)
+			return
+		}
+		text, keyboard, err = h.unsubscribePage(userID, data.page)
+		notice = "Subscription is restored"
+	}
+	if errors.Is(err, service.ErrSubscriptionNotFound) {
+		// subscription has been removed by another message,
+		// so the list is shown again
+		text, keyboard, err = h.unsubscribePage(userID, data.page)
+		notice = "Subscription is already removed"
+	}
+	if err != nil {
+		return
+	}
+
+	err = h.edit(c.Message, text, keyboard)
+	if err != nil {
+		logger.With(zap.Error(err)).Error("failed to edit message")
+		return
+	}
+
+	resp.Text = notice
+	resp.ShowAlert = false
+}
+
+// OutdatedCallback handles buttons that are sent by old versions of the bot.
+func (h *handler) OutdatedCallback(c *tb.Callback) {
+	err := h.bot.Respond(c, &tb.CallbackResponse{
+		CallbackID: c.ID,
+		ShowAlert:  true,
+		Text:       "This message is outdated, send the command again.",
+	})
+	if err != nil {
+		zap.L().
+			Named("handler").
+			With(zap.Error(err)).
+			Error("failed to respond")
+	}
+}
+
+// unsubscribePage returns text and keyboard of the page
+// of subscriptions to choose one to remove.
+func (h *handler) unsubscribePage(userID, page int) (string, *tb.ReplyMarkup, error) {
+	subs, err := h.srv.GetUserSubscriptions(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(subs) == 0 {
+		return "You have no subscriptions.", new(tb.ReplyMarkup), nil
+	}
+	sortSubscriptions(subs)
+
+	start, end, page, pages := paginate(len(subs), page, unsubscribePageSize)
+
+	text := "Choose subscription to remove:"
+	if pages > 1 {
+		text = fmt.Sprintf("Choose subscription to remove (page %d of %d):", page+1, pages)
+	}
+
+	return text, generateReplyMarkup(subs[start:end], page, pages), nil
+}
+
+// unsubscribeConfirmation returns text and keyboard
+// that ask to confirm removal of the subscription.
+func (h *handler) unsubscribeConfirmation(userID int, data unsubscribeData) (string, *tb.ReplyMarkup, error) {
+	sub, err := h.srv.GetSubscription(userID, data.id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	selector := new(tb.ReplyMarkup)
+	selector.Inline(selector.Row(
+		selector.Data("✅ Unsubscribe", unsubscribeUnique,
+			unsubscribeData{action: actionRemove, page: data.page, id: sub.ID}.String()),
+		selector.Data("« Back", unsubscribeUnique,
+			unsubscribeData{action: actionPage, page: data.page}.String()),
+	))
+
+	text := fmt.Sprintf("Unsubscribe from *%s*?\n%s", escapeMarkdown(sub.AppName), escapeMarkdown(sub.Link))
+	return text, selector, nil
+}
+
+// unsubscribeRemove removes the subscription and returns text and keyboard
+// that allow to undo removal.
+func (h *handler) unsubscribeRemove(userID int, data unsubscribeData) (string, *tb.ReplyMarkup, error) {
+	sub, err := h.srv.GetSubscription(userID, data.id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = h.srv.Unsubscribe(userID, sub.Link)
+	if err != nil {
+		return "", nil, err
+	}
+
+	selector := new(tb.ReplyMarkup)
+	var row tb.Row
+	// link of the subscription is stored in callback data as code
+	if code, err := beta.LinkCode(sub.Link); err == nil {
+		undo := unsubscribeData{action: actionUndo, page: data.page, code: code, status: sub.LastStatus}
+		if !sub.CreatedAt.IsZero() {
+			undo.created = sub.CreatedAt.Unix()
+		}
+		row = append(row, selector.Data("↩️ Undo", unsubscribeUnique, undo.String()))
+	}
+	row = append(row, selector.Data("« Back", unsubscribeUnique,
+		unsubscribeData{action: actionPage, page: data.page}.String()))
+	selector.Inline(row)
+
+	text := fmt.Sprintf("You have been unsubscribed from *%s*.", escapeMarkdown(sub.AppName))
+	return text, selector, nil
+}
+
+// edit edits text and keyboard of the message.
+// Keyboard is kept if it is nil.
+// It is not an error if message is not changed.
+func (h *handler) edit(m *tb.Message, text string, keyboard *tb.ReplyMarkup) error {
+	opts := []interface{}{tb.NoPreview, tb.ModeMarkdown}
+	if keyboard != nil {
+		opts = append(opts, keyboard)
+	}
+
+	_, err := h.bot.Edit(m, text, opts...)
+	if errors.Is(err, tb.ErrSameMessageContent) || errors.Is(err, tb.ErrMessageNotModified) {
+		return nil
+	}
+
+	return err
+}
+
+// generateReplyMarkup returns keyboard of the page of subscriptions
+// where every button asks to confirm removal of the subscription.
+func generateReplyMarkup(subs []service.Subscription, page, pages int) *tb.ReplyMarkup {
+	selector := new(tb.ReplyMarkup)
+	rows := make([]tb.Row, 0, len(subs)+1)
+	for _, val := range subs {
+		label := val.AppName
+		if details := betaDetails(val.Metadata.Developer, val.Metadata.Platforms); details != "" {
+			label += " (" + details + ")"
+		}
+
+		rows = append(rows, selector.Row(
+			selector.Data(
+				label,
+				unsubscribeUnique,
+				unsubscribeData{action: actionConfirm, page: page, id: val.ID}.String(),
+			),
+		))
+	}
+
+	row := pageRow(selector, unsubscribeUnique, page, pages, func(page int) string {
+		return unsubscribeData{action: actionPage, page: page}.String()
+	})
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	selector.Inline(rows...)
+	return selector
+}
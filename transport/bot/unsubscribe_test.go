@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestUnsubscribeData(t *testing.T) {
+	for _, d := range []unsubscribeData{
+		{action: actionPage, page: 2},
+		{action: actionConfirm, page: 0, id: 42},
+		{action: actionRemove, page: 1, id: 9223372036854775807},
+		{action: actionUndo, page: 3, code: "AbCd1234"},
+		{action: actionUndo, page: 3, code: "AbCd1234", status: "not_accepting", created: 1650000000},
+	} {
+		encoded := d.String()
+		// Telegram limits callback data to 64 bytes
+		// including unique of the button.
+		if len(encoded)+len(unsubscribeUnique)+2 > 64 {
+			t.Errorf("callback data %q is too long", encoded)
+		}
+
+		decoded, err := parseUnsubscribeData(encoded)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", encoded, err)
+			continue
+		}
+		if decoded != d {
+			t.Errorf("parsed %q as %+v, want %+v", encoded, decoded, d)
+		}
+	}
+}
+
+func TestParseUnsubscribeDataInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"https://testflight.apple.com/join/AbCd1234",
+		"1|p|0",
+		"1|u|0|AbCd1234",
+		"2|x|0",
+		"2|p",
+		"2|p|-1",
+		"2|p|0|1",
+		"2|c|0",
+		"2|c|0|0",
+		"2|r|0|abc",
+		"2|u|0|AbCd1234",
+		"2|u|0|short||0",
+		"2|u|0|testflight.apple.com/join/AbCd1234||0",
+		"2|u|0|AbCd1234|opened|0",
+		"2|u|0|AbCd1234|open|-1",
+		"2|u|0|AbCd1234|open|now",
+	} {
+		_, err := parseUnsubscribeData(data)
+		if !errors.Is(err, errInvalidCallbackData) {
+			t.Errorf("parseUnsubscribeData(%q) = %v, want errInvalidCallbackData", data, err)
+		}
+	}
+}
+
+func TestUnsubscribeServiceError(t *testing.T) {
+	b, sent := newSendBot(t)
+	h := newHandler(b, failingService{}, "")
+
+	h.Unsubscribe(&tb.Message{Sender: &tb.User{ID: 1}})
+
+	texts := sent()
+	if len(texts) != 1 || texts[0] != internalErrorText {
+		t.Fatalf("unexpected sent messages: %q", texts)
+	}
+}